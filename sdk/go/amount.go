@@ -0,0 +1,60 @@
+package satgate
+
+import (
+	"errors"
+	"time"
+)
+
+// ============================================================================
+// Invoice Amounts
+// ============================================================================
+
+// AmountDecoder extracts the amount an invoice requests, in millisatoshis
+// (zero for an invoice without an amount). The client uses it to find what
+// a challenge will cost before paying, so budgets, per-payment limits, rate
+// limits, approval callbacks and spend stats all see its result. By default
+// the client decodes BOLT11 and BOLT12 invoices itself; set an AmountDecoder
+// with WithAmountDecoder, e.g. one backed by a full BOLT11 library, to read
+// the amount differently or to pay invoices the client can't decode.
+type AmountDecoder interface {
+	DecodeAmountMsat(invoice string) (int64, error)
+}
+
+// AmountDecoderFunc adapts a function to the AmountDecoder interface.
+type AmountDecoderFunc func(invoice string) (int64, error)
+
+// DecodeAmountMsat calls f(invoice).
+func (f AmountDecoderFunc) DecodeAmountMsat(invoice string) (int64, error) {
+	return f(invoice)
+}
+
+// WithAmountDecoder replaces how the client reads invoice amounts. The
+// decoder is consulted instead of the client's own invoice decoding, so it
+// can also handle invoices the client would reject; the client then pays
+// them without checking their expiry or the preimage the wallet returns. nil
+// restores the default.
+func WithAmountDecoder(decoder AmountDecoder) ClientOption {
+	return func(client *Client) {
+		client.amountDecoder = decoder
+	}
+}
+
+// decodePaymentRequest decodes a BOLT11 or BOLT12 invoice, returning its
+// amount, payment hash and expiry.
+func decodePaymentRequest(invoice string) (amountMsat int64, paymentHash []byte, expiresAt time.Time, err error) {
+	if isBolt12Invoice(invoice) {
+		decoded, err := decodeBolt12Invoice(invoice)
+		if err != nil {
+			return 0, nil, time.Time{}, err
+		}
+		return decoded.amountMsat, decoded.paymentHash, decoded.expiresAt(), nil
+	}
+	decoded, err := decodeBolt11(invoice)
+	if err != nil {
+		return 0, nil, time.Time{}, err
+	}
+	if decoded.amountMsat < 0 {
+		return 0, nil, time.Time{}, errors.New("negative amount")
+	}
+	return decoded.amountMsat, decoded.paymentHash, decoded.expiresAt(), nil
+}
@@ -0,0 +1,382 @@
+package satgate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+// ============================================================================
+// BOLT11 Invoice Decoding
+// ============================================================================
+
+// bolt11Currencies lists the known BOLT11 currency prefixes, longest first so
+// that e.g. "bcrt" is matched before "bc".
+var bolt11Currencies = []string{"bcrt", "tbs", "bc", "tb", "sb"}
+
+// msatPerBTC is the number of millisatoshis in one bitcoin.
+const msatPerBTC = 100_000_000_000
+
+// invoiceAmountMsat extracts the amount encoded in the human-readable part of
+// a BOLT11 invoice (e.g. "lnbc2500u1..."). Zero-amount invoices return 0 with
+// a nil error.
+func invoiceAmountMsat(invoice string) (int64, error) {
+	invoice = strings.ToLower(strings.TrimSpace(invoice))
+	invoice = strings.TrimPrefix(invoice, "lightning:")
+
+	sep := strings.LastIndexByte(invoice, '1')
+	if sep < 0 || !strings.HasPrefix(invoice, "ln") {
+		return 0, fmt.Errorf("not a BOLT11 invoice")
+	}
+	hrp := invoice[2:sep]
+
+	amount, known := "", false
+	for _, cur := range bolt11Currencies {
+		if strings.HasPrefix(hrp, cur) {
+			amount, known = hrp[len(cur):], true
+			break
+		}
+	}
+	if !known {
+		return 0, fmt.Errorf("unknown invoice currency prefix %q", hrp)
+	}
+	if amount == "" {
+		return 0, nil
+	}
+
+	// The amount is a decimal number followed by an optional multiplier.
+	multiplier := amount[len(amount)-1]
+	digits := amount
+	if multiplier >= 'a' && multiplier <= 'z' {
+		digits = amount[:len(amount)-1]
+	} else {
+		multiplier = 0
+	}
+
+	// ParseInt would take a sign, and '-' is valid in the human-readable
+	// part, so insist on digits: "lnbc-1000u1..." is no refund.
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid invoice amount %q", amount)
+	}
+	value, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid invoice amount %q", amount)
+	}
+
+	var msat int64
+	switch multiplier {
+	case 0:
+		msat, err = mulMsat(value, msatPerBTC)
+	case 'm':
+		msat, err = mulMsat(value, msatPerBTC/1_000)
+	case 'u':
+		msat, err = mulMsat(value, msatPerBTC/1_000_000)
+	case 'n':
+		msat, err = mulMsat(value, msatPerBTC/1_000_000_000)
+	case 'p':
+		// Pico-bitcoin amounts must be whole millisatoshis.
+		if value%10 != 0 {
+			return 0, fmt.Errorf("invalid sub-millisatoshi amount %q", amount)
+		}
+		msat = value / 10
+	default:
+		return 0, fmt.Errorf("invalid invoice amount multiplier %q", multiplier)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid invoice amount %q: %w", amount, err)
+	}
+	return msat, nil
+}
+
+// Invoice is a decoded BOLT11 invoice.
+type Invoice struct {
+	AmountSat   int64         // 0 for a zero-amount invoice
+	AmountMsat  int64         // exact amount in millisatoshis
+	Description string        // empty if the invoice commits to a description hash instead
+	PaymentHash string        // hex-encoded
+	Expiry      time.Duration // how long after Timestamp the invoice is payable
+	Payee       string        // hex-encoded compressed public key of the payee node
+	Timestamp   time.Time     // creation time
+}
+
+// ExpiresAt returns the time after which the invoice can no longer be paid.
+func (inv *Invoice) ExpiresAt() time.Time {
+	return inv.Timestamp.Add(inv.Expiry)
+}
+
+// DecodeInvoice decodes a BOLT11 invoice (with or without a "lightning:"
+// prefix), verifying its checksum. If the invoice doesn't name its payee, the
+// payee is recovered from the signature.
+func DecodeInvoice(bolt11 string) (*Invoice, error) {
+	decoded, err := decodeBolt11(bolt11)
+	if err != nil {
+		return nil, err
+	}
+
+	payee := decoded.payee
+	if payee == nil {
+		if payee, err = decoded.recoverPayee(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Invoice{
+		AmountSat:   msatToSat(decoded.amountMsat),
+		AmountMsat:  decoded.amountMsat,
+		Description: decoded.description,
+		PaymentHash: hex.EncodeToString(decoded.paymentHash),
+		Expiry:      decoded.expiry,
+		Payee:       hex.EncodeToString(payee),
+		Timestamp:   time.Unix(decoded.timestamp, 0),
+	}, nil
+}
+
+// bolt11Invoice holds the fields of a BOLT11 invoice that SatGate relies on.
+type bolt11Invoice struct {
+	amountMsat  int64
+	timestamp   int64
+	paymentHash []byte
+	description string
+	expiry      time.Duration
+	payee       []byte // from the 'n' field; nil if the invoice omits it
+
+	// What the signature covers, and the signature itself, for recovering
+	// the payee when there is no 'n' field.
+	hrp       string
+	signed    []byte // 5-bit groups
+	signature []byte // 5-bit groups
+}
+
+// BOLT11 tagged field types.
+const (
+	bolt11TagPaymentHash = 1  // 'p'
+	bolt11TagExpiry      = 6  // 'x'
+	bolt11TagDescription = 13 // 'd'
+	bolt11TagPayee       = 19 // 'n'
+)
+
+// bolt11DefaultExpiry applies when an invoice has no 'x' field.
+const bolt11DefaultExpiry = time.Hour
+
+// expiresAt returns the time after which the invoice can no longer be paid.
+func (inv *bolt11Invoice) expiresAt() time.Time {
+	return time.Unix(inv.timestamp, 0).Add(inv.expiry)
+}
+
+// recoverPayee recovers the payee's public key from the invoice signature.
+func (inv *bolt11Invoice) recoverPayee() ([]byte, error) {
+	sig, err := convertBits(inv.signature, 5, 8, false)
+	if err != nil || len(sig) != 65 || sig[64] > 3 {
+		return nil, errors.New("invalid invoice signature")
+	}
+	signed, err := convertBits(inv.signed, 5, 8, true)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(append([]byte(inv.hrp), signed...))
+
+	// RecoverCompact expects the recovery flag first, offset as for a
+	// compressed key.
+	compact := append([]byte{27 + 4 + sig[64]}, sig[:64]...)
+	pub, _, err := ecdsa.RecoverCompact(compact, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid invoice signature: %w", err)
+	}
+	return pub.SerializeCompressed(), nil
+}
+
+// decodeBolt11 decodes a BOLT11 invoice, verifying its bech32 checksum.
+func decodeBolt11(invoice string) (*bolt11Invoice, error) {
+	invoice = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(invoice)), "lightning:")
+
+	amountMsat, err := invoiceAmountMsat(invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	hrp, data, err := bech32Decode(invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	// 35-bit timestamp, tagged fields, then a 520-bit (104-group) signature.
+	const timestampLen, signatureLen = 7, 104
+	if len(data) < timestampLen+signatureLen {
+		return nil, errors.New("invoice too short")
+	}
+
+	inv := &bolt11Invoice{
+		amountMsat: amountMsat,
+		timestamp:  int64(readUint(data[:timestampLen])),
+		expiry:     bolt11DefaultExpiry,
+		hrp:        hrp,
+		signed:     data[:len(data)-signatureLen],
+		signature:  data[len(data)-signatureLen:],
+	}
+
+	fields := data[timestampLen : len(data)-signatureLen]
+	for len(fields) > 0 {
+		if len(fields) < 3 {
+			return nil, errors.New("truncated tagged field")
+		}
+		tag := fields[0]
+		length := int(fields[1])<<5 | int(fields[2])
+		if len(fields) < 3+length {
+			return nil, errors.New("truncated tagged field")
+		}
+		value := fields[3 : 3+length]
+		fields = fields[3+length:]
+
+		switch tag {
+		case bolt11TagPaymentHash:
+			// Fields of unexpected length must be skipped, per BOLT11.
+			if length != 52 || inv.paymentHash != nil {
+				continue
+			}
+			if inv.paymentHash, err = convertBits(value, 5, 8, false); err != nil {
+				return nil, err
+			}
+		case bolt11TagDescription:
+			description, err := convertBits(value, 5, 8, false)
+			if err != nil {
+				return nil, fmt.Errorf("invalid description: %w", err)
+			}
+			inv.description = string(description)
+		case bolt11TagExpiry:
+			inv.expiry = time.Duration(readUint(value)) * time.Second
+		case bolt11TagPayee:
+			if length != 53 {
+				continue
+			}
+			if inv.payee, err = convertBits(value, 5, 8, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if inv.paymentHash == nil {
+		return nil, errors.New("invoice has no payment hash")
+	}
+	return inv, nil
+}
+
+// msatToSat converts millisatoshis to satoshis, rounding any remainder up so
+// that spend tracking never under-reports.
+func msatToSat(msat int64) int64 {
+	return (msat + 999) / 1000
+}
+
+func mulMsat(value, factor int64) (int64, error) {
+	if value < 0 {
+		return 0, fmt.Errorf("negative amount")
+	}
+	if value != 0 && value > (1<<63-1)/factor {
+		return 0, fmt.Errorf("amount overflows")
+	}
+	return value * factor, nil
+}
+
+// readUint interprets 5-bit groups as a big-endian unsigned integer.
+func readUint(groups []byte) uint64 {
+	var v uint64
+	for _, g := range groups {
+		v = v<<5 | uint64(g)
+	}
+	return v
+}
+
+// ============================================================================
+// Bech32
+// ============================================================================
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Decode decodes a bech32 string into its human-readable part and its
+// 5-bit data groups, with the checksum verified and stripped. Unlike BIP-173
+// no length limit is enforced, since Lightning invoices routinely exceed it.
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("bech32: mixed case")
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, errors.New("bech32: invalid separator position")
+	}
+	hrp := s[:sep]
+
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("bech32: invalid character %q", s[i])
+		}
+		data = append(data, byte(v))
+	}
+
+	if bech32Polymod(append(bech32HRPExpand(hrp), data...)) != 1 {
+		return "", nil, errors.New("bech32: invalid checksum")
+	}
+	return hrp, data[:len(data)-6], nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// convertBits regroups data from fromBits-wide to toBits-wide groups.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+	out := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, errors.New("bech32: invalid data range")
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("bech32: invalid padding")
+	}
+	return out, nil
+}
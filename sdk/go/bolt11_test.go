@@ -0,0 +1,177 @@
+package satgate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInvoiceAmountMsat(t *testing.T) {
+	tests := []struct {
+		invoice string
+		msat    int64
+		wantErr bool
+	}{
+		{invoice: "lnbc2500u1xyz", msat: 250_000_000},
+		{invoice: "lnbc1m1xyz", msat: 100_000_000},
+		{invoice: "lnbc10n1xyz", msat: 1_000},
+		{invoice: "lnbc10p1xyz", msat: 1},
+		{invoice: "lnbc2bc1xyz", wantErr: true},
+		{invoice: "lnbc3", wantErr: true},
+		{invoice: "lnbc1xyz", msat: 0},
+		{invoice: "lntb20m1xyz", msat: 2_000_000_000},
+		{invoice: "lnbcrt5u1xyz", msat: 500_000},
+		{invoice: "lntbs7n1xyz", msat: 700},
+		{invoice: " LIGHTNING:LNBC2500U1XYZ ", msat: 250_000_000},
+		{invoice: "lnbc15p1xyz", wantErr: true},
+		{invoice: "lnbc-1000u1xyz", wantErr: true},
+		{invoice: "lnbc+1000u1xyz", wantErr: true},
+		{invoice: "lnbc-1u1xyz", wantErr: true},
+		{invoice: "lnbc1-0u1xyz", wantErr: true},
+		{invoice: "lnbcu1xyz", wantErr: true},
+		{invoice: "lnbc99999999999999999999u1xyz", wantErr: true},
+		{invoice: "lnbc999999999991xyz", wantErr: true},
+		{invoice: "lnxx2500u1xyz", wantErr: true},
+		{invoice: "bc1qxyz", wantErr: true},
+	}
+	for _, tt := range tests {
+		msat, err := invoiceAmountMsat(tt.invoice)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("invoiceAmountMsat(%q) = %d, want an error", tt.invoice, msat)
+			}
+			continue
+		}
+		if err != nil || msat != tt.msat {
+			t.Errorf("invoiceAmountMsat(%q) = %d, %v; want %d", tt.invoice, msat, err, tt.msat)
+		}
+	}
+}
+
+func TestDecodeBolt11(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xab}, 32)
+	payee := append([]byte{0x02}, bytes.Repeat([]byte{0x11}, 32)...)
+	const timestamp = 1_700_000_000
+
+	tests := []struct {
+		name        string
+		invoice     string
+		wantErr     bool
+		msat        int64
+		description string
+		expiry      time.Duration
+		payee       []byte
+	}{
+		{
+			name:        "all fields",
+			invoice:     testInvoice("lnbc2500u", timestamp, tagged(1, toGroups(hash)), tagged(13, toGroups([]byte("coffee"))), tagged(6, []byte{18, 24}), tagged(19, toGroups(payee))),
+			msat:        250_000_000,
+			description: "coffee",
+			expiry:      600 * time.Second,
+			payee:       payee,
+		},
+		{
+			name:    "default expiry",
+			invoice: testInvoice("lnbc", timestamp, tagged(1, toGroups(hash))),
+			expiry:  time.Hour,
+		},
+		{
+			name:    "lightning URI",
+			invoice: "LIGHTNING:" + strings.ToUpper(testInvoice("lntb10n", timestamp, tagged(1, toGroups(hash)))),
+			msat:    1_000,
+			expiry:  time.Hour,
+		},
+		{
+			name:    "unknown and odd-length fields skipped",
+			invoice: testInvoice("lnbc", timestamp, tagged(1, toGroups(hash[:31])), tagged(1, toGroups(hash)), tagged(24, []byte{1, 2, 3}), tagged(19, []byte{1})),
+			expiry:  time.Hour,
+		},
+		{
+			name:    "no payment hash",
+			invoice: testInvoice("lnbc", timestamp, tagged(13, toGroups([]byte("coffee")))),
+			wantErr: true,
+		},
+		{
+			name:    "truncated field",
+			invoice: testInvoice("lnbc", timestamp, tagged(1, toGroups(hash))[:20]),
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			invoice: testBech32("lnbc", make([]byte, 100)),
+			wantErr: true,
+		},
+		{
+			name:    "bad checksum",
+			invoice: testInvoice("lnbc", timestamp, tagged(1, toGroups(hash))) + "q",
+			wantErr: true,
+		},
+		{
+			name:    "mixed case",
+			invoice: "lnbc1QQQQQQQ",
+			wantErr: true,
+		},
+		{
+			name:    "invalid character",
+			invoice: "lnbc1qqqqqqqbqqqqqq",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		inv, err := decodeBolt11(tt.invoice)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: decodeBolt11 succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: decodeBolt11: %v", tt.name, err)
+			continue
+		}
+		if inv.amountMsat != tt.msat || inv.description != tt.description || inv.expiry != tt.expiry ||
+			!bytes.Equal(inv.paymentHash, hash) || !bytes.Equal(inv.payee, tt.payee) {
+			t.Errorf("%s: decoded amount %d, description %q, expiry %s, hash %x, payee %x",
+				tt.name, inv.amountMsat, inv.description, inv.expiry, inv.paymentHash, inv.payee)
+		}
+		if want := time.Unix(timestamp, 0).Add(tt.expiry); !inv.expiresAt().Equal(want) {
+			t.Errorf("%s: expiresAt() = %s, want %s", tt.name, inv.expiresAt(), want)
+		}
+	}
+}
+
+// testInvoice encodes an invoice with the given tagged fields and an all-zero
+// signature, which decodeBolt11 doesn't check.
+func testInvoice(hrp string, timestamp int64, fields ...[]byte) string {
+	var data []byte
+	for i := 6; i >= 0; i-- {
+		data = append(data, byte(timestamp>>(5*i)&31))
+	}
+	for _, field := range fields {
+		data = append(data, field...)
+	}
+	return testBech32(hrp, append(data, make([]byte, 104)...))
+}
+
+func tagged(tag byte, value []byte) []byte {
+	return append([]byte{tag, byte(len(value) >> 5), byte(len(value) & 31)}, value...)
+}
+
+func toGroups(b []byte) []byte {
+	groups, _ := convertBits(b, 8, 5, true)
+	return groups
+}
+
+func testBech32(hrp string, data []byte) string {
+	checksum := bech32Polymod(append(append(bech32HRPExpand(hrp), data...), 0, 0, 0, 0, 0, 0)) ^ 1
+	var sb strings.Builder
+	sb.WriteString(hrp + "1")
+	for _, v := range data {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[checksum>>(5*(5-i))&31])
+	}
+	return sb.String()
+}
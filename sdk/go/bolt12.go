@@ -0,0 +1,199 @@
+package satgate
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// BOLT12 Invoice Decoding
+// ============================================================================
+
+// bolt12Invoice holds the fields of a BOLT12 invoice ("lni1...") that
+// SatGate relies on.
+type bolt12Invoice struct {
+	amountMsat  int64
+	createdAt   int64
+	paymentHash []byte
+	expiry      time.Duration
+	chain       []byte // chain hash; nil for bitcoin mainnet
+}
+
+// BOLT12 invoice TLV types.
+const (
+	bolt12TypeOfferChains    = 2
+	bolt12TypeInvreqChain    = 80
+	bolt12TypeCreatedAt      = 164
+	bolt12TypeRelativeExpiry = 166
+	bolt12TypePaymentHash    = 168
+	bolt12TypeAmount         = 170
+)
+
+// bolt12DefaultExpiry applies when an invoice has no relative expiry.
+const bolt12DefaultExpiry = 7200 * time.Second
+
+// bolt12InvoicePrefix starts every BOLT12 invoice.
+const bolt12InvoicePrefix = "lni1"
+
+// bolt12Networks maps chain hashes (genesis block hashes, in the byte order
+// BOLT12 uses) to network names.
+var bolt12Networks = map[string]string{
+	"6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000": "mainnet",
+	"43497fd7f826957108f4a30fd9cec3aeba79972084e90ead01ea330900000000": "testnet",
+	"f61eee3b63a380a477a063af32b2bbc97c9ff9f01f2c4225e973988108000000": "signet",
+	"06226e46111a0b59caaf126043eb5bbf28c34f3a5e332a1fc7b2b73cf188910f": "regtest",
+}
+
+// isBolt12Invoice reports whether s is a BOLT12 invoice.
+func isBolt12Invoice(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(strings.TrimPrefix(s, "lightning:"), bolt12InvoicePrefix)
+}
+
+// expiresAt returns the time after which the invoice can no longer be paid.
+func (inv *bolt12Invoice) expiresAt() time.Time {
+	return time.Unix(inv.createdAt, 0).Add(inv.expiry)
+}
+
+// network returns the name of the network the invoice is for.
+func (inv *bolt12Invoice) network() (string, error) {
+	if inv.chain == nil {
+		return "mainnet", nil
+	}
+	if network, ok := bolt12Networks[hex.EncodeToString(inv.chain)]; ok {
+		return network, nil
+	}
+	return "", errors.New("unknown invoice chain")
+}
+
+// decodeBolt12Invoice decodes a BOLT12 invoice. BOLT12 strings carry no
+// checksum, and the signature is not checked: the wallet that fetched the
+// invoice has already verified it against the offer.
+func decodeBolt12Invoice(invoice string) (*bolt12Invoice, error) {
+	data, err := bolt12Bytes(invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &bolt12Invoice{expiry: bolt12DefaultExpiry}
+	for len(data) > 0 {
+		tlvType, n, err := readBigSize(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[n:]
+		length, n, err := readBigSize(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[n:]
+		if uint64(len(data)) < length {
+			return nil, errors.New("truncated invoice field")
+		}
+		value := data[:length]
+		data = data[length:]
+
+		switch tlvType {
+		case bolt12TypeOfferChains:
+			// An invreq_chain, if present, says which of these was chosen.
+			if len(value) >= 32 && inv.chain == nil {
+				inv.chain = value[:32]
+			}
+		case bolt12TypeInvreqChain:
+			if len(value) != 32 {
+				return nil, errors.New("invalid invoice chain")
+			}
+			inv.chain = value
+		case bolt12TypeCreatedAt:
+			createdAt, err := readTruncatedUint(value)
+			if err != nil {
+				return nil, err
+			}
+			inv.createdAt = int64(createdAt)
+		case bolt12TypeRelativeExpiry:
+			expiry, err := readTruncatedUint(value)
+			if err != nil {
+				return nil, err
+			}
+			inv.expiry = time.Duration(expiry) * time.Second
+		case bolt12TypePaymentHash:
+			if len(value) != 32 {
+				return nil, errors.New("invalid invoice payment hash")
+			}
+			inv.paymentHash = value
+		case bolt12TypeAmount:
+			amount, err := readTruncatedUint(value)
+			if err != nil {
+				return nil, err
+			}
+			if amount > 1<<63-1 {
+				return nil, errors.New("amount overflows")
+			}
+			inv.amountMsat = int64(amount)
+		}
+	}
+
+	if inv.paymentHash == nil {
+		return nil, errors.New("invoice has no payment hash")
+	}
+	if inv.createdAt == 0 {
+		return nil, errors.New("invoice has no creation time")
+	}
+	return inv, nil
+}
+
+// bolt12Bytes returns the TLV stream of a BOLT12 string: bech32 characters
+// after the "lni1" prefix, without a checksum, optionally split into parts
+// joined by "+" and whitespace.
+func bolt12Bytes(invoice string) ([]byte, error) {
+	invoice = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(invoice)), "lightning:")
+	if !strings.HasPrefix(invoice, bolt12InvoicePrefix) {
+		return nil, fmt.Errorf("not a BOLT12 invoice")
+	}
+	invoice = strings.Join(strings.Fields(strings.ReplaceAll(invoice, "+", " ")), "")
+
+	groups := make([]byte, 0, len(invoice)-len(bolt12InvoicePrefix))
+	for _, ch := range invoice[len(bolt12InvoicePrefix):] {
+		v := strings.IndexRune(bech32Charset, ch)
+		if v < 0 {
+			return nil, fmt.Errorf("invalid character %q in invoice", ch)
+		}
+		groups = append(groups, byte(v))
+	}
+	return convertBits(groups, 5, 8, false)
+}
+
+// readBigSize reads a BOLT1 BigSize integer, returning it and its length.
+func readBigSize(data []byte) (uint64, int, error) {
+	if len(data) == 0 {
+		return 0, 0, errors.New("truncated invoice field")
+	}
+	switch size := data[0]; {
+	case size < 0xfd:
+		return uint64(size), 1, nil
+	case size == 0xfd && len(data) >= 3:
+		return uint64(binary.BigEndian.Uint16(data[1:])), 3, nil
+	case size == 0xfe && len(data) >= 5:
+		return uint64(binary.BigEndian.Uint32(data[1:])), 5, nil
+	case size == 0xff && len(data) >= 9:
+		return binary.BigEndian.Uint64(data[1:]), 9, nil
+	}
+	return 0, 0, errors.New("truncated invoice field")
+}
+
+// readTruncatedUint reads a BOLT1 truncated unsigned integer (tu32/tu64):
+// big-endian, with leading zero bytes omitted.
+func readTruncatedUint(value []byte) (uint64, error) {
+	if len(value) > 8 {
+		return 0, errors.New("invalid invoice integer")
+	}
+	var v uint64
+	for _, b := range value {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
@@ -0,0 +1,175 @@
+package satgate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeBolt12Invoice(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xab}, 32)
+	regtest := []byte{0x06, 0x22, 0x6e, 0x46, 0x11, 0x1a, 0x0b, 0x59, 0xca, 0xaf, 0x12, 0x60, 0x43, 0xeb, 0x5b, 0xbf,
+		0x28, 0xc3, 0x4f, 0x3a, 0x5e, 0x33, 0x2a, 0x1f, 0xc7, 0xb2, 0xb7, 0x3c, 0xf1, 0x88, 0x91, 0x0f}
+	createdAt := tlv(bolt12TypeCreatedAt, []byte{0x65, 0x53, 0xf1, 0x00}) // 1700000000
+	paymentHash := tlv(bolt12TypePaymentHash, hash)
+
+	tests := []struct {
+		name    string
+		invoice string
+		wantErr bool
+		msat    int64
+		expiry  time.Duration
+		network string
+	}{
+		{
+			name:    "all fields",
+			invoice: testBolt12(tlv(bolt12TypeOfferChains, regtest), createdAt, tlv(bolt12TypeRelativeExpiry, []byte{0x02, 0x58}), paymentHash, tlv(bolt12TypeAmount, []byte{0x03, 0xe8})),
+			msat:    1_000,
+			expiry:  600 * time.Second,
+			network: "regtest",
+		},
+		{
+			name:    "defaults",
+			invoice: testBolt12(createdAt, paymentHash),
+			expiry:  bolt12DefaultExpiry,
+			network: "mainnet",
+		},
+		{
+			name:    "invreq chain wins",
+			invoice: testBolt12(tlv(bolt12TypeOfferChains, make([]byte, 32)), tlv(bolt12TypeInvreqChain, regtest), createdAt, paymentHash),
+			expiry:  bolt12DefaultExpiry,
+			network: "regtest",
+		},
+		{
+			name:    "unknown fields skipped",
+			invoice: testBolt12(tlv(1, []byte{1, 2, 3}), createdAt, paymentHash, tlv(240, make([]byte, 64))),
+			expiry:  bolt12DefaultExpiry,
+			network: "mainnet",
+		},
+		{
+			name:    "split lightning URI",
+			invoice: "LIGHTNING:" + splitBolt12(strings.ToUpper(testBolt12(createdAt, paymentHash))),
+			expiry:  bolt12DefaultExpiry,
+			network: "mainnet",
+		},
+		{
+			name:    "no payment hash",
+			invoice: testBolt12(createdAt),
+			wantErr: true,
+		},
+		{
+			name:    "no creation time",
+			invoice: testBolt12(paymentHash),
+			wantErr: true,
+		},
+		{
+			name:    "short payment hash",
+			invoice: testBolt12(createdAt, tlv(bolt12TypePaymentHash, hash[:31])),
+			wantErr: true,
+		},
+		{
+			name:    "short invreq chain",
+			invoice: testBolt12(tlv(bolt12TypeInvreqChain, regtest[:31]), createdAt, paymentHash),
+			wantErr: true,
+		},
+		{
+			name:    "truncated field",
+			invoice: testBolt12(createdAt, paymentHash[:20]),
+			wantErr: true,
+		},
+		{
+			name:    "oversized integer",
+			invoice: testBolt12(createdAt, paymentHash, tlv(bolt12TypeAmount, make([]byte, 9))),
+			wantErr: true,
+		},
+		{
+			name:    "amount overflows",
+			invoice: testBolt12(createdAt, paymentHash, tlv(bolt12TypeAmount, bytes.Repeat([]byte{0xff}, 8))),
+			wantErr: true,
+		},
+		{
+			name:    "invalid character",
+			invoice: testBolt12(createdAt, paymentHash) + "b",
+			wantErr: true,
+		},
+		{
+			name:    "not BOLT12",
+			invoice: "lno1qqqq",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		inv, err := decodeBolt12Invoice(tt.invoice)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: decodeBolt12Invoice succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: decodeBolt12Invoice: %v", tt.name, err)
+			continue
+		}
+		network, err := inv.network()
+		if inv.amountMsat != tt.msat || inv.expiry != tt.expiry || !bytes.Equal(inv.paymentHash, hash) || network != tt.network || err != nil {
+			t.Errorf("%s: decoded amount %d, expiry %s, hash %x, network %q (%v)",
+				tt.name, inv.amountMsat, inv.expiry, inv.paymentHash, network, err)
+		}
+		if want := time.Unix(1_700_000_000, 0).Add(tt.expiry); !inv.expiresAt().Equal(want) {
+			t.Errorf("%s: expiresAt() = %s, want %s", tt.name, inv.expiresAt(), want)
+		}
+	}
+}
+
+func TestReadBigSize(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		value   uint64
+		n       int
+		wantErr bool
+	}{
+		{data: []byte{0x00}, value: 0, n: 1},
+		{data: []byte{0xfc, 0xaa}, value: 0xfc, n: 1},
+		{data: []byte{0xfd, 0x01, 0x00}, value: 0x100, n: 3},
+		{data: []byte{0xfe, 0x00, 0x01, 0x00, 0x00}, value: 0x10000, n: 5},
+		{data: []byte{0xff, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}, value: 0x100000000, n: 9},
+		{data: nil, wantErr: true},
+		{data: []byte{0xfd, 0x01}, wantErr: true},
+		{data: []byte{0xfe, 0x00, 0x01, 0x00}, wantErr: true},
+		{data: []byte{0xff, 0x00}, wantErr: true},
+	}
+	for _, tt := range tests {
+		value, n, err := readBigSize(tt.data)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("readBigSize(%x) = %d, want an error", tt.data, value)
+			}
+			continue
+		}
+		if err != nil || value != tt.value || n != tt.n {
+			t.Errorf("readBigSize(%x) = %d, %d, %v; want %d, %d", tt.data, value, n, err, tt.value, tt.n)
+		}
+	}
+}
+
+// testBolt12 encodes a TLV stream as a BOLT12 invoice string.
+func testBolt12(records ...[]byte) string {
+	groups, _ := convertBits(bytes.Join(records, nil), 8, 5, true)
+	var sb strings.Builder
+	sb.WriteString(bolt12InvoicePrefix)
+	for _, v := range groups {
+		sb.WriteByte(bech32Charset[v])
+	}
+	return sb.String()
+}
+
+// splitBolt12 splits a BOLT12 string into parts joined by "+" and whitespace.
+func splitBolt12(s string) string {
+	return s[:20] + "+\n  " + s[20:40] + " + " + s[40:]
+}
+
+// tlv encodes a TLV record whose type and length fit in a single byte.
+func tlv(tlvType byte, value []byte) []byte {
+	return append([]byte{tlvType, byte(len(value))}, value...)
+}
@@ -0,0 +1,137 @@
+package satgate
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// ============================================================================
+// Token Cache Encryption
+// ============================================================================
+
+// WithTokenEncryptionKey encrypts the macaroons and preimages the client
+// hands to its CacheStore with AES-GCM under key, which must be 16, 24 or 32
+// bytes long (AES-128, -192 or -256); TokenKeyFromPassphrase derives one from
+// a passphrase. Cache keys (URLs) and expiry times are stored in the clear.
+//
+// Tokens are decrypted on load. If key is invalid, or the stored tokens
+// can't be decrypted with it (because they were encrypted with another key,
+// or stored in plaintext), the client stops persisting tokens rather than
+// overwrite them. It reports this as an error wrapping ErrTokenCacheKey,
+// both from CacheStoreErr and on the logger, or on stderr if there is none.
+// A plaintext cache from before encryption was turned on must be deleted.
+func WithTokenEncryptionKey(key []byte) ClientOption {
+	return func(client *Client) {
+		client.tokenCipher, client.tokenCipherErr = newTokenCipher(key)
+	}
+}
+
+func newTokenCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenCacheKey, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// passphraseSalt and passphraseIterations parameterize
+// TokenKeyFromPassphrase. The salt is fixed so that the same passphrase
+// always yields the same key without storing anything beside the cache.
+const (
+	passphraseSalt       = "satgate token cache"
+	passphraseIterations = 600_000
+)
+
+// TokenKeyFromPassphrase derives a 32-byte key for WithTokenEncryptionKey
+// from passphrase with PBKDF2-HMAC-SHA256. A random key kept in a secret
+// store is stronger; use this when a passphrase is all there is.
+func TokenKeyFromPassphrase(passphrase string) []byte {
+	return pbkdf2SHA256([]byte(passphrase), []byte(passphraseSalt), passphraseIterations)
+}
+
+// pbkdf2SHA256 is PBKDF2-HMAC-SHA256 (RFC 8018) for a 32-byte key, i.e. a
+// single block.
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, password)
+	prf.Write(salt)
+	binary.Write(prf, binary.BigEndian, uint32(1))
+	u := prf.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+// encryptedPrefix marks a StoredToken field sealed by WithTokenEncryptionKey.
+const encryptedPrefix = "aesgcm:"
+
+// sealToken encrypts t's macaroon and preimage if a token key is set. The
+// cache key is authenticated along with them, so sealed fields can't be
+// moved to another entry.
+func (c *Client) sealToken(t StoredToken) (StoredToken, error) {
+	if c.tokenCipher == nil {
+		return t, nil
+	}
+	var err error
+	if t.Macaroon, err = c.sealField(t.Key, t.Macaroon); err != nil {
+		return t, err
+	}
+	t.Preimage, err = c.sealField(t.Key, t.Preimage)
+	return t, err
+}
+
+func (c *Client) sealField(key, value string) (string, error) {
+	nonce := make([]byte, c.tokenCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.tokenCipher.Seal(nonce, nonce, []byte(value), []byte(key))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openToken decrypts t's sealed fields. Plaintext fields are returned as
+// they are if no token key is set, and refused if one is.
+func (c *Client) openToken(t StoredToken) (StoredToken, error) {
+	var err error
+	if t.Macaroon, err = c.openField(t.Key, t.Macaroon); err != nil {
+		return t, err
+	}
+	t.Preimage, err = c.openField(t.Key, t.Preimage)
+	return t, err
+}
+
+func (c *Client) openField(key, value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		if c.tokenCipher != nil {
+			return "", fmt.Errorf("%w: tokens are stored unencrypted", ErrTokenCacheKey)
+		}
+		return value, nil
+	}
+	if c.tokenCipher == nil {
+		return "", fmt.Errorf("%w: tokens are encrypted but no key is set (WithTokenEncryptionKey)", ErrTokenCacheKey)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	nonceSize := c.tokenCipher.NonceSize()
+	if err != nil || len(sealed) < nonceSize {
+		return "", fmt.Errorf("%w: malformed encrypted token", ErrTokenCacheKey)
+	}
+	plain, err := c.tokenCipher.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("%w: tokens were encrypted with a different key", ErrTokenCacheKey)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,96 @@
+package satgate
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Token Cache Persistence
+// ============================================================================
+
+// StoredToken is a cached L402 token as handed to a CacheStore.
+type StoredToken struct {
+	Key       string    `json:"key"`
+	Macaroon  string    `json:"macaroon"`
+	Preimage  string    `json:"preimage"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CacheStore persists the token cache so that paid tokens survive process
+// restarts. Load is called once when the client is created; Save is called
+// with the full set of unexpired tokens whenever a new token is cached.
+type CacheStore interface {
+	Load() ([]StoredToken, error)
+	Save(tokens []StoredToken) error
+}
+
+// FileCacheStore is a CacheStore that keeps tokens in a JSON file.
+//
+// The file holds preimages, which are proof of payment, so it is written with
+// owner-only permissions.
+type FileCacheStore struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFileCacheStore creates a file-backed cache store at path.
+func NewFileCacheStore(path string) *FileCacheStore {
+	return &FileCacheStore{Path: path}
+}
+
+// Load reads the tokens from disk. A missing file is not an error.
+func (s *FileCacheStore) Load() ([]StoredToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []StoredToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Save writes the tokens to disk, replacing the file atomically so a crash
+// mid-write can't leave it truncated.
+func (s *FileCacheStore) Save(tokens []StoredToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.Path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".satgate-cache-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
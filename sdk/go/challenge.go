@@ -0,0 +1,347 @@
+package satgate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ============================================================================
+// L402 Challenge Parsing
+// ============================================================================
+
+// WithChallengeParser replaces the built-in parsing of payment challenges
+// for gateways that encode them in a non-standard way. parse is given each
+// challenge response (a 402, or a 401 if WithChallengeOn401 is set) and
+// returns the macaroon and invoice to pay. Returning neither, with no error,
+// means the response carries no challenge and it is handed back as is; an
+// error fails the call with ErrInvalidL402Header. A parser that reads the
+// body should put it back (e.g. with a bytes.Reader), since the response
+// may still be returned or quoted in a ChallengeError.
+//
+// It applies to HTTP responses only; Authorize parses its header as usual.
+func WithChallengeParser(parse func(*http.Response) (macaroon, invoice string, err error)) ClientOption {
+	return func(client *Client) {
+		client.challengeParser = parse
+	}
+}
+
+// authChallenge is one challenge from a WWW-Authenticate header (RFC 7235):
+// an auth scheme followed by either a token68 or a list of parameters.
+type authChallenge struct {
+	scheme  string
+	token68 string
+	params  map[string]string // keys lower-cased
+}
+
+// challengeOption is one macaroon and invoice pair offered by a challenge.
+type challengeOption struct {
+	macaroon string
+	invoice  string
+}
+
+// parseL402Header extracts the macaroon and invoice from a WWW-Authenticate
+// header. A BOLT12 offer (offer="lno1...") stands in for the invoice, and a
+// keysend challenge (keysend="<pubkey>", amount="<sats>") yields a keysend
+// hint in its place. Both the "L402" and legacy "LSAT" schemes are accepted,
+// alongside other challenges in the same header (e.g. `Bearer realm="x",
+// L402 ...`).
+// The macaroon may be given as macaroon="...", token="..." or positionally
+// (`L402 <macaroon>, invoice="..."`). The error names the missing field.
+//
+// A server with tiered pricing may send several L402 challenges, each with
+// its own macaroon and invoice; every complete one is returned, in order,
+// for the client to choose from (see WithInvoiceSelector).
+func parseL402Header(header string) ([]challengeOption, error) {
+	challenges := parseAuthChallenges(header)
+
+	var l402 []*authChallenge
+	for i := range challenges {
+		if isL402Scheme(challenges[i].scheme) {
+			l402 = append(l402, &challenges[i])
+		}
+	}
+	if len(l402) == 0 {
+		// Tolerate servers that send the parameters under another scheme
+		// name, as long as it unambiguously carries a macaroon.
+		for i := range challenges {
+			if challenges[i].params["macaroon"] != "" {
+				l402 = append(l402, &challenges[i])
+				break
+			}
+		}
+	}
+	if len(l402) == 0 {
+		return nil, errors.New("no L402 or LSAT challenge in WWW-Authenticate header")
+	}
+
+	var options []challengeOption
+	var firstErr error
+	for _, challenge := range l402 {
+		macaroon, invoice, err := parseL402Challenge(challenge)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		options = append(options, challengeOption{macaroon, invoice})
+	}
+	if len(options) == 0 {
+		return nil, firstErr
+	}
+	return options, nil
+}
+
+// parseL402Challenge extracts the macaroon and invoice from one challenge.
+func parseL402Challenge(l402 *authChallenge) (macaroon, invoice string, err error) {
+	macaroon = l402.params["macaroon"]
+	if macaroon == "" {
+		macaroon = l402.params["token"]
+	}
+	if macaroon == "" && l402.token68 != "" {
+		// Positional form, possibly in the "<macaroon>:<preimage>" shape of
+		// an Authorization header; only the macaroon part is meaningful here.
+		macaroon, _, _ = strings.Cut(l402.token68, ":")
+	}
+	invoice = l402.params["invoice"]
+	if invoice == "" {
+		invoice = l402.params["offer"]
+	}
+	if invoice == "" && l402.params["keysend"] != "" {
+		invoice, err = keysendChallenge(l402.params["keysend"], l402.params["amount"])
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	switch {
+	case macaroon == "" && invoice == "":
+		return "", "", errors.New("L402 challenge is missing both macaroon and invoice")
+	case macaroon == "":
+		return "", "", errors.New("L402 challenge is missing the macaroon")
+	case invoice == "":
+		return "", "", errors.New("L402 challenge is missing the invoice")
+	}
+	return macaroon, invoice, nil
+}
+
+func isL402Scheme(scheme string) bool {
+	return strings.EqualFold(scheme, "L402") || strings.EqualFold(scheme, "LSAT")
+}
+
+// parseAuthChallenges splits a WWW-Authenticate header value into its
+// challenges. It is lenient: malformed fragments are skipped rather than
+// failing the whole header.
+func parseAuthChallenges(header string) []authChallenge {
+	var challenges []authChallenge
+	var current *authChallenge
+	afterScheme := false // the previous token was a scheme, with no comma since
+
+	s := header
+	i := 0
+	skipSpace := func(j int) int {
+		for j < len(s) && (s[j] == ' ' || s[j] == '\t') {
+			j++
+		}
+		return j
+	}
+
+	for i < len(s) {
+		if s[i] == ',' {
+			afterScheme = false
+			i++
+			continue
+		}
+		if s[i] == ' ' || s[i] == '\t' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && !strings.ContainsRune(" \t,=\"", rune(s[i])) {
+			i++
+		}
+		if i == start {
+			i++ // stray '=' or '"'
+			continue
+		}
+		token := s[start:i]
+
+		j := skipSpace(i)
+		if j < len(s) && s[j] == '=' {
+			// Either name=value, or a token68 ending in '=' padding.
+			k := j
+			for k < len(s) && s[k] == '=' {
+				k++
+			}
+			m := skipSpace(k)
+			if afterScheme && j == i && (m == len(s) || s[m] == ',') {
+				current.token68 = token + s[j:k]
+				afterScheme = false
+				i = k
+				continue
+			}
+
+			value, next := readParamValue(s, skipSpace(j+1))
+			if current != nil {
+				current.params[strings.ToLower(token)] = value
+			}
+			afterScheme = false
+			i = next
+			continue
+		}
+
+		if afterScheme {
+			current.token68 = token
+			afterScheme = false
+			continue
+		}
+
+		challenges = append(challenges, authChallenge{scheme: token, params: map[string]string{}})
+		current = &challenges[len(challenges)-1]
+		afterScheme = true
+	}
+	return challenges
+}
+
+// readParamValue reads a quoted-string or token starting at i, returning the
+// unescaped value and the index just past it.
+func readParamValue(s string, i int) (string, int) {
+	if i < len(s) && s[i] == '"' {
+		var b strings.Builder
+		i++
+		for i < len(s) && s[i] != '"' {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			b.WriteByte(s[i])
+			i++
+		}
+		return b.String(), i + 1
+	}
+
+	start := i
+	for i < len(s) && s[i] != ',' && s[i] != ' ' && s[i] != '\t' {
+		i++
+	}
+	return s[start:i], i
+}
+
+// hasL402Challenge reports whether resp's WWW-Authenticate headers include
+// an L402 or LSAT challenge.
+func hasL402Challenge(resp *http.Response) bool {
+	for _, challenge := range parseAuthChallenges(strings.Join(resp.Header.Values("WWW-Authenticate"), ", ")) {
+		if isL402Scheme(challenge.scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// readChallenges extracts the L402 challenge from a 402 response: from its
+// WWW-Authenticate headers or, when they carry no usable L402 challenge
+// (e.g. only `Bearer realm="..."`), from a JSON body such as
+// {"macaroon": "...", "invoice": "..."}. found is false if the response
+// carries neither. A body that is inspected is restored, so resp can still be
+// handed back to the caller.
+func readChallenges(resp *http.Response) (options []challengeOption, found bool, err error) {
+	// Servers may send several WWW-Authenticate headers; consider them all.
+	if header := strings.Join(resp.Header.Values("WWW-Authenticate"), ", "); header != "" {
+		options, err = parseL402Header(header)
+		if err == nil {
+			return options, true, nil
+		}
+		if macaroon, invoice, ok := readChallengeBody(resp); ok {
+			return []challengeOption{{macaroon, invoice}}, true, nil
+		}
+		return nil, true, fmt.Errorf("%w: %v", ErrInvalidL402Header, err)
+	}
+
+	macaroon, invoice, found := readChallengeBody(resp)
+	if !found {
+		return nil, false, nil
+	}
+	return []challengeOption{{macaroon, invoice}}, true, nil
+}
+
+// readChallengeBody looks for a challenge in a JSON body, restoring the body
+// afterwards.
+func readChallengeBody(resp *http.Response) (macaroon, invoice string, found bool) {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return "", "", false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxChallengeBodyBytes))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	if err != nil {
+		return "", "", false
+	}
+
+	// net/http decompresses transparently unless the caller set their own
+	// Accept-Encoding; then the body is handed back compressed, as they
+	// asked, but we still need to read the challenge in it.
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") && !resp.Uncompressed {
+		if body, err = gunzip(body); err != nil {
+			return "", "", false
+		}
+	}
+	return parseL402Body(body)
+}
+
+// gunzip decompresses up to maxChallengeBodyBytes of a gzip body.
+func gunzip(body []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, maxChallengeBodyBytes))
+}
+
+// maxChallengeBodyBytes caps how much of a 402 body is read looking for a
+// JSON challenge.
+const maxChallengeBodyBytes = 64 << 10
+
+// parseL402Body extracts a challenge from a JSON 402 body. Besides
+// "macaroon" and "invoice" it accepts the common alternatives "token" and
+// "payment_request"/"paymentRequest"/"pr"/"bolt11", and a keysend challenge
+// as "keysend" and "amount". found is false unless both a macaroon and an
+// invoice (or keysend hint) are present.
+func parseL402Body(body []byte) (macaroon, invoice string, found bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", "", false
+	}
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			var s string
+			if json.Unmarshal(fields[key], &s) == nil && s != "" {
+				return s
+			}
+		}
+		return ""
+	}
+	macaroon = first("macaroon", "token")
+	invoice = first("invoice", "payment_request", "paymentRequest", "pr", "bolt11", "offer")
+	if dest := first("keysend"); invoice == "" && dest != "" {
+		var amount json.Number // a number or a numeric string
+		_ = json.Unmarshal(fields["amount"], &amount)
+		invoice, _ = keysendChallenge(dest, amount.String())
+	}
+	if macaroon == "" || invoice == "" {
+		return "", "", false
+	}
+	return macaroon, invoice, true
+}
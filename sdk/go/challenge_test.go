@@ -0,0 +1,175 @@
+package satgate
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAuthChallenges(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		challenges []authChallenge
+	}{
+		{
+			name:   "params",
+			header: `L402 macaroon="AgEE", invoice="lnbc1"`,
+			challenges: []authChallenge{
+				{scheme: "L402", params: map[string]string{"macaroon": "AgEE", "invoice": "lnbc1"}},
+			},
+		},
+		{
+			name:   "token68",
+			header: `L402 AgEEbHNhdA, invoice="lnbc1"`,
+			challenges: []authChallenge{
+				{scheme: "L402", token68: "AgEEbHNhdA", params: map[string]string{"invoice": "lnbc1"}},
+			},
+		},
+		{
+			name:   "token68 with padding",
+			header: `LSAT AgEEbHNhdA==, invoice=lnbc1`,
+			challenges: []authChallenge{
+				{scheme: "LSAT", token68: "AgEEbHNhdA==", params: map[string]string{"invoice": "lnbc1"}},
+			},
+		},
+		{
+			name:   "token68 with padding at end",
+			header: `L402 AgEEbHNhdA=`,
+			challenges: []authChallenge{
+				{scheme: "L402", token68: "AgEEbHNhdA=", params: map[string]string{}},
+			},
+		},
+		{
+			name:   "param is not token68",
+			header: `L402 macaroon=AgEE`,
+			challenges: []authChallenge{
+				{scheme: "L402", params: map[string]string{"macaroon": "AgEE"}},
+			},
+		},
+		{
+			name:   "spaces around equals",
+			header: `L402 Macaroon = "AgEE" , INVOICE= "lnbc1"`,
+			challenges: []authChallenge{
+				{scheme: "L402", params: map[string]string{"macaroon": "AgEE", "invoice": "lnbc1"}},
+			},
+		},
+		{
+			name:   "escaped quotes and commas",
+			header: `L402 macaroon="a\"b,c", invoice="lnbc1"`,
+			challenges: []authChallenge{
+				{scheme: "L402", params: map[string]string{"macaroon": `a"b,c`, "invoice": "lnbc1"}},
+			},
+		},
+		{
+			name:   "several challenges",
+			header: `Bearer realm="api", L402 macaroon="m1", invoice="i1", L402 macaroon="m2", invoice="i2"`,
+			challenges: []authChallenge{
+				{scheme: "Bearer", params: map[string]string{"realm": "api"}},
+				{scheme: "L402", params: map[string]string{"macaroon": "m1", "invoice": "i1"}},
+				{scheme: "L402", params: map[string]string{"macaroon": "m2", "invoice": "i2"}},
+			},
+		},
+		{
+			name:   "scheme without params",
+			header: `Basic, L402 AgEE`,
+			challenges: []authChallenge{
+				{scheme: "Basic", params: map[string]string{}},
+				{scheme: "L402", token68: "AgEE", params: map[string]string{}},
+			},
+		},
+		{
+			name:   "malformed fragments skipped",
+			header: `=, "stray", L402 ,, macaroon="AgEE", invoice="lnbc1`,
+			challenges: []authChallenge{
+				{scheme: "stray", params: map[string]string{}},
+				{scheme: "L402", params: map[string]string{"macaroon": "AgEE", "invoice": "lnbc1"}},
+			},
+		},
+		{
+			name:   "empty",
+			header: "",
+		},
+	}
+	for _, tt := range tests {
+		challenges := parseAuthChallenges(tt.header)
+		if !reflect.DeepEqual(challenges, tt.challenges) {
+			t.Errorf("%s: parseAuthChallenges(%q) = %+v, want %+v", tt.name, tt.header, challenges, tt.challenges)
+		}
+	}
+}
+
+func TestParseL402Header(t *testing.T) {
+	tests := []struct {
+		header  string
+		options []challengeOption
+		wantErr bool
+	}{
+		{header: `L402 macaroon="m", invoice="i"`, options: []challengeOption{{"m", "i"}}},
+		{header: `L402 token="m", invoice="i"`, options: []challengeOption{{"m", "i"}}},
+		{header: `L402 m:preimage, invoice="i"`, options: []challengeOption{{"m", "i"}}},
+		{header: `L402 macaroon="m", offer="lno1"`, options: []challengeOption{{"m", "lno1"}}},
+		{header: `Custom macaroon="m", invoice="i"`, options: []challengeOption{{"m", "i"}}},
+		{header: `L402 macaroon="m1", L402 macaroon="m2", invoice="i2"`, options: []challengeOption{{"m2", "i2"}}},
+		{header: `L402 macaroon="m"`, wantErr: true},
+		{header: `L402 invoice="i"`, wantErr: true},
+		{header: `L402 realm="api"`, wantErr: true},
+		{header: `Bearer realm="api"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		options, err := parseL402Header(tt.header)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseL402Header(%q) = %+v, want an error", tt.header, options)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(options, tt.options) {
+			t.Errorf("parseL402Header(%q) = %+v, %v; want %+v", tt.header, options, err, tt.options)
+		}
+	}
+}
+
+func TestReadChallenges(t *testing.T) {
+	const jsonBody = `{"macaroon": "mb", "invoice": "ib"}`
+	tests := []struct {
+		name        string
+		header      string
+		contentType string
+		body        string
+		options     []challengeOption
+		found       bool
+		wantErr     bool
+	}{
+		{name: "header", header: `L402 macaroon="mh", invoice="ih"`, contentType: "application/json", body: jsonBody, options: []challengeOption{{"mh", "ih"}}, found: true},
+		{name: "body without header", contentType: "application/json", body: jsonBody, options: []challengeOption{{"mb", "ib"}}, found: true},
+		{name: "body with other scheme", header: `Bearer realm="api"`, contentType: "application/problem+json", body: jsonBody, options: []challengeOption{{"mb", "ib"}}, found: true},
+		{name: "body with incomplete header", header: `L402 macaroon="mh"`, contentType: "application/json", body: jsonBody, options: []challengeOption{{"mb", "ib"}}, found: true},
+		{name: "other scheme without body", header: `Bearer realm="api"`, contentType: "text/plain", body: jsonBody, found: true, wantErr: true},
+		{name: "other scheme with unrelated JSON", header: `Bearer realm="api"`, contentType: "application/json", body: `{"error": "payment required"}`, found: true, wantErr: true},
+		{name: "nothing", contentType: "text/plain", body: "pay up"},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{
+			Header: http.Header{"Content-Type": {tt.contentType}},
+			Body:   io.NopCloser(strings.NewReader(tt.body)),
+		}
+		if tt.header != "" {
+			resp.Header.Set("WWW-Authenticate", tt.header)
+		}
+
+		options, found, err := readChallenges(resp)
+		if (err != nil) != tt.wantErr || (tt.wantErr && !errors.Is(err, ErrInvalidL402Header)) {
+			t.Errorf("%s: err = %v, want error %t", tt.name, err, tt.wantErr)
+		}
+		if found != tt.found || !reflect.DeepEqual(options, tt.options) {
+			t.Errorf("%s: readChallenges = %+v, %t; want %+v, %t", tt.name, options, found, tt.options, tt.found)
+		}
+		if body, _ := io.ReadAll(resp.Body); string(body) != tt.body {
+			t.Errorf("%s: body after reading = %q, want %q", tt.name, body, tt.body)
+		}
+	}
+}
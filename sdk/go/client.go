@@ -13,12 +13,25 @@ package satgate
 
 import (
 	"bytes"
+	"container/list"
+	"context"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math/rand"
 	"net/http"
-	"regexp"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -29,41 +42,183 @@ type LightningWallet interface {
 	PayInvoice(invoice string) (preimage string, err error)
 }
 
+// BalanceChecker is implemented by wallets that can report their spendable
+// balance, used by WithPreflightBalanceCheck.
+type BalanceChecker interface {
+	Balance() (int64, error)
+}
+
 // PaymentInfo contains information about a completed payment.
 type PaymentInfo struct {
-	Invoice   string    `json:"invoice"`
-	Preimage  string    `json:"preimage"`
-	Macaroon  string    `json:"macaroon"`
-	Endpoint  string    `json:"endpoint"`
-	Timestamp time.Time `json:"timestamp"`
+	Invoice     string    `json:"invoice"`
+	Preimage    string    `json:"preimage"`
+	PaymentHash string    `json:"payment_hash"` // hex, for matching wallet records
+	Macaroon    string    `json:"macaroon"`
+	Endpoint    string    `json:"endpoint"`
+	AmountSat   int64     `json:"amount_sat"`
+	FeeSat      int64     `json:"fee_sat"` // routing fee, if the wallet reports it
+	Timestamp   time.Time `json:"timestamp"`
 }
 
 // TokenCache stores L402 tokens for reuse.
 type TokenCache struct {
 	mu     sync.RWMutex
 	tokens map[string]*cachedToken
+
+	maxEntries int        // 0 means unbounded
+	lru        *list.List // keys, most recently used first; nil if unbounded
+
+	// scopes holds, by cache key, the tokens whose macaroons make them
+	// valid for every URL under a prefix (see macaroonScope).
+	scopes map[string]tokenScope
 }
 
 type cachedToken struct {
+	key       string
 	macaroon  string
 	preimage  string
 	expiresAt time.Time
+
+	elem *list.Element // position in the LRU list
+}
+
+// put stores token under key, evicting the least recently used tokens if
+// the cache is over its size limit. The caller must hold mu.
+func (tc *TokenCache) put(key string, token *cachedToken) {
+	tc.remove(key)
+	token.key = key
+	tc.tokens[key] = token
+	if tc.lru == nil {
+		return
+	}
+	token.elem = tc.lru.PushFront(key)
+	for len(tc.tokens) > tc.maxEntries {
+		tc.remove(tc.lru.Back().Value.(string))
+	}
+}
+
+// remove deletes the token under key, and any scope it was registered for.
+// The caller must hold mu.
+func (tc *TokenCache) remove(key string) {
+	if token, ok := tc.tokens[key]; ok {
+		if token.elem != nil {
+			tc.lru.Remove(token.elem)
+		}
+		delete(tc.tokens, key)
+	}
+	delete(tc.scopes, key)
+}
+
+// touch marks token, cached under key, as just used.
+func (tc *TokenCache) touch(key string, token *cachedToken) {
+	if tc.lru == nil {
+		return
+	}
+	tc.mu.Lock()
+	if tc.tokens[key] == token {
+		tc.lru.MoveToFront(token.elem)
+	}
+	tc.mu.Unlock()
 }
 
 // Client is the SatGate HTTP client that automatically handles L402 payments.
 type Client struct {
 	wallet     LightningWallet
 	httpClient *http.Client
+	transport  *http.Transport // the default transport, if not replaced
 	cache      *TokenCache
 	cacheTTL   time.Duration
+	cacheKey   func(method, url string) string
+	cacheStore CacheStore
+	cacheSize  int // max cached tokens, 0 for unbounded
+	ttlJitter  float64
+
+	tokenCipher    cipher.AEAD // WithTokenEncryptionKey; nil stores tokens in plaintext
+	tokenCipherErr error       // an invalid key, which disables persistence
+	cacheStoreErr  error       // why persistence was turned off; see CacheStoreErr
+
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	proxy               proxyFunc
+	insecureTLS         bool
+
+	tracer Tracer
+
+	now func() time.Time // clock for cache expiry and invoice checks
+
+	sweepInterval time.Duration
+	closeOnce     sync.Once
+	closed        chan struct{} // closed by Close to stop background work
+
+	// background is the context for work not tied to a request, such as
+	// proactive refreshes. Close cancels it.
+	background       context.Context
+	cancelBackground context.CancelFunc
+	proactiveRefresh bool
+
 	verbose    bool
+	verboseOut io.Writer
+	logger     *slog.Logger
+
+	baseURL        string
+	requestTimeout time.Duration
+	authFormatter  func(macaroon, preimage string) http.Header
+	preimageHeader string
+	defaultHeaders map[string]string
+	userAgent      string
+	bodyMarshaler  func(v interface{}) ([]byte, string, error)
+	requestGzip    bool
+	requestHook    func(*http.Request) error
+	responseHook   func(*http.Response) error
+
+	maxResponseBytes int64
+
+	challengeOn401 bool
+
+	storeMu sync.Mutex // serializes snapshots written to cacheStore
 
 	// Callbacks
-	OnPayment func(info PaymentInfo)
+	OnPayment      func(info PaymentInfo)
+	OnChallenge    func(invoice string, amountSat int64)
+	OnRetry        func(url string, attempt int)
+	approvePayment func(invoice string, amountSat int64) bool
+
+	// Spending limits
+	maxBudgetSat  int64
+	maxPaymentSat int64
+	spendLimiter  *spendLimiter
+	rateLimitWait bool
+
+	preflightBalance bool
+	dryRun           bool
+	expirySkew       time.Duration
+	expectedNetwork  string
+	amountDecoder    AmountDecoder
+
+	// Payment retry
+	paymentAttempts   int
+	paymentRetryDelay time.Duration
+	paymentTimeout    time.Duration
+
+	maxParts int // WithMaxParts, applied to LND wallets
 
 	// Stats
-	mu           sync.Mutex
-	TotalPaidSat int64
+	mu         sync.Mutex
+	stats      Stats
+	pendingSat int64 // reserved by payments still in flight
+
+	historySize int
+	history     []PaymentInfo // ring buffer of recent payments
+	historyNext int           // index of the oldest entry once history is full
+
+	dedupWindow    time.Duration
+	recentPayments map[string]recentPayment // by payment hash (hex)
+
+	invoiceSelector func([]Invoice) int // nil picks the cheapest
+
+	challengeParser func(*http.Response) (macaroon, invoice string, err error)
+
+	payments map[string]*inflightPayment // in-flight payments by cache key
 }
 
 // ClientOption configures a Client.
@@ -76,13 +231,202 @@ func WithHTTPClient(c *http.Client) ClientOption {
 	}
 }
 
-// WithCacheTTL sets the token cache TTL.
+// WithUserAgent sets the User-Agent header sent with every request. The
+// default is "satgate-go/<Version>".
+func WithUserAgent(userAgent string) ClientOption {
+	return func(client *Client) {
+		client.userAgent = userAgent
+	}
+}
+
+// WithDefaultHeaders sets headers sent with every request. Per-call headers
+// (WithHeader) take precedence over them. An Authorization header is sent on
+// requests made without an L402 token, but is replaced by the L402
+// Authorization whenever a cached or freshly paid token is presented.
+func WithDefaultHeaders(headers map[string]string) ClientOption {
+	return func(client *Client) {
+		if client.defaultHeaders == nil {
+			client.defaultHeaders = make(map[string]string, len(headers))
+		}
+		for k, v := range headers {
+			client.defaultHeaders[k] = v
+		}
+	}
+}
+
+// newTransport returns the client's default transport: Go's default
+// (keep-alives, HTTP/2 when the server supports it) with more idle
+// connections kept per host, since L402 clients tend to call the same API
+// host over and over.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 16
+	transport.ForceAttemptHTTP2 = true
+	return transport
+}
+
+// WithMaxIdleConnsPerHost sets how many idle (keep-alive) connections the
+// client keeps per host (default 16). It tunes the default transport, so it has
+// no effect together with WithHTTPClient.
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return func(client *Client) {
+		client.maxIdleConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection is kept open before
+// being closed (default 90 seconds). It tunes the default transport, so it has
+// no effect together with WithHTTPClient.
+func WithIdleConnTimeout(d time.Duration) ClientOption {
+	return func(client *Client) {
+		client.idleConnTimeout = d
+	}
+}
+
+// WithCacheTTL sets the token cache TTL. A TTL of zero or less disables the
+// cache: every request that gets a 402 pays again.
 func WithCacheTTL(ttl time.Duration) ClientOption {
 	return func(client *Client) {
 		client.cacheTTL = ttl
 	}
 }
 
+// defaultTTLJitter is the default spread applied to the cache TTL.
+const defaultTTLJitter = 0.1
+
+// WithCacheTTLJitter varies each token's cache TTL by a random amount of up
+// to ±fraction (0.1 means ±10%, the default), so tokens paid for in a burst
+// don't all expire, and get paid for again, at the same instant. Zero
+// disables the jitter. Expiry caveats in the macaroon are still honoured
+// exactly.
+func WithCacheTTLJitter(fraction float64) ClientOption {
+	return func(client *Client) {
+		client.ttlJitter = fraction
+	}
+}
+
+// WithClock replaces the clock the client uses for token expiry, invoice
+// expiry and spend rate limiting. It exists for tests that need to advance
+// time deterministically.
+func WithClock(now func() time.Time) ClientOption {
+	return func(client *Client) {
+		client.now = now
+	}
+}
+
+// WithCacheSweep starts a background goroutine that removes expired tokens
+// from the cache every interval. Expired tokens are also evicted when looked
+// up, so sweeping only matters for clients that touch many distinct URLs.
+// Call Close to stop the sweeper.
+func WithCacheSweep(interval time.Duration) ClientOption {
+	return func(client *Client) {
+		client.sweepInterval = interval
+	}
+}
+
+// WithMaxCacheEntries bounds the token cache to n entries. When it is full,
+// caching another token evicts the least recently used one. By default the
+// cache is unbounded, which a long-running client that touches many distinct
+// URLs may want to avoid; WithCacheSweep only removes expired tokens.
+func WithMaxCacheEntries(n int) ClientOption {
+	return func(client *Client) {
+		client.cacheSize = n
+	}
+}
+
+// WithCacheKeyFunc sets how requests map to cached tokens. Requests with the
+// same key share a token. The default keys on the full URL, query included,
+// regardless of method; use CacheKeyByMethod when the server scopes tokens to
+// a method, or CacheKeyByPath when one macaroon covers every query of an
+// endpoint.
+func WithCacheKeyFunc(fn func(method, url string) string) ClientOption {
+	return func(client *Client) {
+		client.cacheKey = fn
+	}
+}
+
+// CacheKeyByPath is a cache key function that keys on scheme, host and path,
+// ignoring the query string and fragment, so that e.g. /premium?page=1 and
+// /premium?page=2 share one token.
+func CacheKeyByPath(method, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host + u.EscapedPath()
+}
+
+// CacheKeyByMethod is a cache key function that keys on the method as well as
+// the full URL, so that e.g. a token paid for by a GET is never presented on
+// a POST to the same URL. Use it with servers whose macaroons are scoped to a
+// method.
+func CacheKeyByMethod(method, rawURL string) string {
+	return method + " " + rawURL
+}
+
+// WithCacheStore persists the token cache in store, so tokens paid for by a
+// previous run are reused instead of paid for again. Tokens are loaded when
+// the client is created, skipping any that have expired.
+func WithCacheStore(store CacheStore) ClientOption {
+	return func(client *Client) {
+		client.cacheStore = store
+	}
+}
+
+// WithRequestTimeout bounds each call as a whole: the initial request, paying
+// the challenge and the authenticated retry together, plus reading the
+// response body. A call that runs out of time fails with an error wrapping
+// context.DeadlineExceeded. The HTTP client's timeout still applies to each
+// request on its own.
+//
+// The deadline reaches the wallet too (see ContextWallet). A payment under
+// way when it passes fails with ErrPaymentInterrupted, but since a payment
+// already sent can't be called back, its amount stays reserved against the
+// budget until the wallet answers, and a late preimage is still counted and
+// cached.
+func WithRequestTimeout(d time.Duration) ClientOption {
+	return func(client *Client) {
+		client.requestTimeout = d
+	}
+}
+
+// WithAuthFormatter sets how a token is presented on the authenticated
+// request, for servers that don't accept the default
+// "Authorization: LSAT <macaroon>:<preimage>". The returned headers replace
+// any of the same name set on the request. For example:
+//
+//	satgate.WithAuthFormatter(func(macaroon, preimage string) http.Header {
+//		return http.Header{
+//			"Authorization": {"L402 " + macaroon + ":" + preimage},
+//		}
+//	})
+func WithAuthFormatter(format func(macaroon, preimage string) http.Header) ClientOption {
+	return func(client *Client) {
+		client.authFormatter = format
+	}
+}
+
+// WithPreimageHeader also sends the preimage on its own in the header name
+// (e.g. "X-Preimage"), for servers that look for proof of payment there. The
+// Authorization header is sent as usual; to send only the macaroon in it,
+// combine this with WithAuthFormatter.
+func WithPreimageHeader(name string) ClientOption {
+	return func(client *Client) {
+		client.preimageHeader = name
+	}
+}
+
+// WithBaseURL resolves the URLs passed to the request methods against
+// baseURL, so that client.Get("/premium") requests
+// https://api.example.com/premium. Resolution follows url.URL.ResolveReference:
+// an absolute URL is used as is, and a relative path replaces the last path
+// segment of baseURL, so end baseURL with "/" to keep a path prefix.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(client *Client) {
+		client.baseURL = baseURL
+	}
+}
+
 // WithVerbose enables verbose logging.
 func WithVerbose(v bool) ClientOption {
 	return func(client *Client) {
@@ -90,6 +434,81 @@ func WithVerbose(v bool) ClientOption {
 	}
 }
 
+// WithVerboseWriter sends verbose output to w instead of stdout, e.g.
+// os.Stderr for tools that print machine-readable output on stdout.
+func WithVerboseWriter(w io.Writer) ClientOption {
+	return func(client *Client) {
+		client.verboseOut = w
+	}
+}
+
+// WithMaxBudgetSat caps the total amount the client will ever pay. Once a
+// payment would push the total past limit, requests fail with
+// ErrBudgetExceeded instead of paying. Zero means no limit.
+func WithMaxBudgetSat(limit int64) ClientOption {
+	return func(client *Client) {
+		client.maxBudgetSat = limit
+	}
+}
+
+// WithMaxPaymentSat refuses any single invoice above maxPerCall sats with
+// ErrPaymentTooLarge, before the wallet is ever asked to pay. Zero means no
+// limit.
+func WithMaxPaymentSat(maxPerCall int64) ClientOption {
+	return func(client *Client) {
+		client.maxPaymentSat = maxPerCall
+	}
+}
+
+// WithPaymentApproval sets a callback that decides, per invoice, whether to
+// pay. It runs after the invoice has been decoded and the spending limits
+// checked; returning false fails the call with ErrPaymentRejected. It may be
+// called concurrently and may block, e.g. to ask a human or a policy service.
+func WithPaymentApproval(approve func(invoice string, amountSat int64) bool) ClientOption {
+	return func(client *Client) {
+		client.approvePayment = approve
+	}
+}
+
+// WithInvoiceExpiryTolerance sets how long past its expiry an invoice is
+// still considered payable, to allow for clock skew between this machine and
+// the invoice issuer. The default is 60 seconds.
+func WithInvoiceExpiryTolerance(d time.Duration) ClientOption {
+	return func(client *Client) {
+		client.expirySkew = d
+	}
+}
+
+// WithDryRun makes the client go through the 402 handshake, decode the
+// invoice and apply spending limits, but stop short of paying: the call fails
+// with ErrDryRun instead of calling the wallet. Use it to exercise payment
+// code paths against a real server without spending sats.
+func WithDryRun(enabled bool) ClientOption {
+	return func(client *Client) {
+		client.dryRun = enabled
+	}
+}
+
+// WithPreflightBalanceCheck makes the client ask the wallet for its balance
+// before paying, failing fast with ErrInsufficientBalance when it can't cover
+// the invoice. It applies to wallets implementing BalanceChecker (e.g.
+// AlbyWallet); routing fees aren't known up front and aren't included.
+func WithPreflightBalanceCheck(enabled bool) ClientOption {
+	return func(client *Client) {
+		client.preflightBalance = enabled
+	}
+}
+
+// WithLogger routes the client's diagnostics to logger as structured records
+// (with fields such as url, status_code, cache_hit, invoice_amount_sat and
+// preimage_prefix) instead of printing emoji lines. Setting a logger turns
+// the verbose printf output off.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(client *Client) {
+		client.logger = logger
+	}
+}
+
 // WithPaymentCallback sets a callback for payment events.
 func WithPaymentCallback(fn func(PaymentInfo)) ClientOption {
 	return func(client *Client) {
@@ -97,175 +516,1515 @@ func WithPaymentCallback(fn func(PaymentInfo)) ClientOption {
 	}
 }
 
+// WithChallengeCallback sets a callback that is called when an L402
+// challenge is received, before any limit checks or payment. Together with
+// the payment callback it can drive a "paying..." state in a UI.
+func WithChallengeCallback(fn func(invoice string, amountSat int64)) ClientOption {
+	return func(client *Client) {
+		client.OnChallenge = fn
+	}
+}
+
+// WithRetryCallback sets a callback that is called before a request is
+// retried with a freshly paid token. attempt counts the retries of the call,
+// starting at 1.
+func WithRetryCallback(fn func(url string, attempt int)) ClientOption {
+	return func(client *Client) {
+		client.OnRetry = fn
+	}
+}
+
 // NewClient creates a new SatGate client.
 func NewClient(wallet LightningWallet, opts ...ClientOption) *Client {
+	transport := newTransport()
 	c := &Client{
 		wallet:     wallet,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		transport:  transport,
 		cache: &TokenCache{
 			tokens: make(map[string]*cachedToken),
 		},
-		cacheTTL: 5 * time.Minute,
-		verbose:  true,
+		cacheTTL:    5 * time.Minute,
+		ttlJitter:   defaultTTLJitter,
+		verbose:     true,
+		verboseOut:  os.Stdout,
+		expirySkew:  60 * time.Second,
+		historySize: defaultHistorySize,
+		dedupWindow: defaultDedupWindow,
+		userAgent:   "satgate-go/" + Version,
+		now:         time.Now,
 	}
 
 	for _, opt := range opts {
 		opt(c)
 	}
 
+	// Transport tuning only applies to the transport we created.
+	if c.httpClient.Transport == c.transport {
+		if c.maxIdleConnsPerHost > 0 {
+			c.transport.MaxIdleConnsPerHost = c.maxIdleConnsPerHost
+		}
+		if c.idleConnTimeout > 0 {
+			c.transport.IdleConnTimeout = c.idleConnTimeout
+		}
+		if c.proxy != nil {
+			c.transport.Proxy = c.proxy
+		}
+	}
+
+	if c.paymentTimeout > 0 {
+		setWalletTimeout(c.wallet, c.paymentTimeout)
+	}
+	if c.proxy != nil {
+		setWalletProxy(c.wallet, c.proxy)
+	}
+	if c.maxParts > 0 {
+		setWalletMaxParts(c.wallet, c.maxParts)
+	}
+	c.applyInsecureTLS()
+
+	if c.cacheSize > 0 {
+		c.cache.maxEntries = c.cacheSize
+		c.cache.lru = list.New()
+	}
+	if c.tokenCipherErr != nil {
+		c.disableCacheStore(c.tokenCipherErr)
+	}
+	if c.cacheStore != nil && c.cacheTTL > 0 {
+		c.loadCache()
+	}
+
+	c.closed = make(chan struct{})
+	c.background, c.cancelBackground = context.WithCancel(context.Background())
+	if c.sweepInterval > 0 {
+		go c.sweepCache(c.sweepInterval, c.closed)
+	}
+
 	return c
 }
 
+// Close releases the client's resources: it stops background work such as
+// the cache sweeper started by WithCacheSweep, closes idle HTTP connections,
+// and closes the wallet if it implements io.Closer (e.g. NWCWallet,
+// LNDWallet). Don't call it while another client still uses the same wallet.
+// It is safe to call more than once. The client must not be used after Close.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.cancelBackground()
+		c.httpClient.CloseIdleConnections()
+		if closer, ok := c.wallet.(io.Closer); ok {
+			err = closer.Close()
+		}
+	})
+	return err
+}
+
 // Get performs a GET request, automatically handling L402 payment challenges.
-func (c *Client) Get(url string) (*http.Response, error) {
-	return c.Do("GET", url, nil)
+func (c *Client) Get(url string, opts ...CallOption) (*http.Response, error) {
+	return c.GetCtx(context.Background(), url, opts...)
+}
+
+// GetCtx is like Get but carries ctx through the request, payment and retry.
+func (c *Client) GetCtx(ctx context.Context, url string, opts ...CallOption) (*http.Response, error) {
+	return c.DoCtx(ctx, "GET", url, nil, opts...)
 }
 
 // Post performs a POST request with JSON body.
-func (c *Client) Post(url string, body interface{}) (*http.Response, error) {
-	return c.Do("POST", url, body)
+func (c *Client) Post(url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.PostCtx(context.Background(), url, body, opts...)
+}
+
+// PostCtx is like Post but carries ctx through the request, payment and retry.
+func (c *Client) PostCtx(ctx context.Context, url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.DoCtx(ctx, "POST", url, body, opts...)
+}
+
+// PostForm performs a POST request with values URL-encoded as the body, like
+// http.PostForm. The Content-Type is application/x-www-form-urlencoded.
+func (c *Client) PostForm(rawURL string, values url.Values, opts ...CallOption) (*http.Response, error) {
+	return c.PostFormCtx(context.Background(), rawURL, values, opts...)
+}
+
+// PostFormCtx is like PostForm but carries ctx through the request, payment
+// and retry.
+func (c *Client) PostFormCtx(ctx context.Context, rawURL string, values url.Values, opts ...CallOption) (*http.Response, error) {
+	return c.DoRawCtx(ctx, "POST", rawURL, strings.NewReader(values.Encode()),
+		"application/x-www-form-urlencoded", opts...)
+}
+
+// Put performs a PUT request with JSON body.
+func (c *Client) Put(url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.PutCtx(context.Background(), url, body, opts...)
+}
+
+// PutCtx is like Put but carries ctx through the request, payment and retry.
+func (c *Client) PutCtx(ctx context.Context, url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.DoCtx(ctx, "PUT", url, body, opts...)
+}
+
+// Patch performs a PATCH request with JSON body.
+func (c *Client) Patch(url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.PatchCtx(context.Background(), url, body, opts...)
+}
+
+// PatchCtx is like Patch but carries ctx through the request, payment and retry.
+func (c *Client) PatchCtx(ctx context.Context, url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.DoCtx(ctx, "PATCH", url, body, opts...)
+}
+
+// Delete performs a DELETE request. body is sent as JSON and may be nil.
+func (c *Client) Delete(url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.DeleteCtx(context.Background(), url, body, opts...)
+}
+
+// DeleteCtx is like Delete but carries ctx through the request, payment and retry.
+func (c *Client) DeleteCtx(ctx context.Context, url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.DoCtx(ctx, "DELETE", url, body, opts...)
 }
 
 // Do performs an HTTP request, handling L402 challenges automatically.
-func (c *Client) Do(method, url string, body interface{}) (*http.Response, error) {
+func (c *Client) Do(method, url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.DoCtx(context.Background(), method, url, body, opts...)
+}
+
+// DoRaw performs an HTTP request with a pre-encoded body, handling L402
+// challenges automatically. The body is sent as-is with the given content
+// type instead of being JSON-encoded. It is read fully up front so it can be
+// replayed on the authenticated retry.
+func (c *Client) DoRaw(method, url string, body io.Reader, contentType string, opts ...CallOption) (*http.Response, error) {
+	return c.DoRawCtx(context.Background(), method, url, body, contentType, opts...)
+}
+
+// DoRawCtx is like DoRaw but carries ctx through the request, payment and retry.
+func (c *Client) DoRawCtx(ctx context.Context, method, url string, body io.Reader, contentType string, opts ...CallOption) (*http.Response, error) {
+	req := &request{method: method, url: url}
+	if body != nil {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %w", err)
+		}
+		req.body, req.contentType = data, contentType
+	}
+	req.apply(opts)
+	return responseOf(c.do(ctx, req))
+}
+
+// DoCtx is like Do but carries ctx through the whole 402 → pay → retry cycle.
+// If ctx is cancelled while paying, the retry is abandoned and ctx.Err() is
+// returned; the token from a payment that did complete stays cached.
+func (c *Client) DoCtx(ctx context.Context, method, url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	req, err := c.newRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.apply(opts)
+	return responseOf(c.do(ctx, req))
+}
+
+// Result is a response together with how SatGate obtained access to it.
+type Result struct {
+	*http.Response
+
+	Paid      bool  // an invoice was paid during this call
+	CacheHit  bool  // a cached L402 token was presented
+	AmountSat int64 // satoshis paid during this call
+}
+
+// responseOf unwraps the response from the result of Client.do.
+func responseOf(r *Result, err error) (*http.Response, error) {
+	if r == nil {
+		return nil, err
+	}
+	return r.Response, err
+}
+
+// DoResult is like Do but also reports whether the call paid an invoice or
+// reused a cached token, and how much it cost. If an error occurs after an
+// invoice was paid, the Result is still returned (with a nil Response) so the
+// spend can be attributed.
+func (c *Client) DoResult(method, url string, body interface{}, opts ...CallOption) (*Result, error) {
+	return c.DoResultCtx(context.Background(), method, url, body, opts...)
+}
+
+// DoResultCtx is like DoResult but carries ctx through the request, payment
+// and retry.
+func (c *Client) DoResultCtx(ctx context.Context, method, url string, body interface{}, opts ...CallOption) (*Result, error) {
+	req, err := c.newRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.apply(opts)
+	return c.do(ctx, req)
+}
+
+// CallOption configures a single request made with Get, Post, Do, etc.
+type CallOption func(*request)
+
+// WithHeader sets a header on a single request, overriding any default
+// header of the same name. See WithDefaultHeaders for how Authorization is
+// handled.
+func WithHeader(key, value string) CallOption {
+	return func(req *request) {
+		if req.headers == nil {
+			req.headers = make(http.Header)
+		}
+		req.headers.Set(key, value)
+	}
+}
+
+// WithFreshToken makes a single request ignore any cached token and go
+// through the 402 handshake and payment again, e.g. when the cached token is
+// suspected bad after the server rotated its keys. The new token replaces
+// the cached one.
+func WithFreshToken() CallOption {
+	return func(req *request) {
+		req.freshToken = true
+	}
+}
+
+// WithCallMaxSat overrides WithMaxPaymentSat for a single request: an
+// invoice above maxSat sats fails it with ErrPaymentTooLarge. The override
+// can be tighter or looser than the client's limit; the budget and spend
+// rate limits still apply. A cached token is used regardless of what it
+// cost, and when concurrent requests share a payment, the limit of the one
+// that pays applies.
+func WithCallMaxSat(maxSat int64) CallOption {
+	return func(req *request) {
+		req.maxPaymentSat = maxSat
+	}
+}
+
+// WithHeaders sets several headers on a single request, like WithHeader.
+func WithHeaders(headers map[string]string) CallOption {
+	return func(req *request) {
+		for k, v := range headers {
+			WithHeader(k, v)(req)
+		}
+	}
+}
+
+// Prewarm pays for an L402 token for url ahead of time, so that a later Get
+// of the same URL is served from the cache with no payment latency. It
+// performs the 402 handshake and payment but not the authenticated retry. If a
+// valid token is already cached, or the URL doesn't require payment, Prewarm
+// does nothing. Concurrent calls for the same URL share a single payment.
+func (c *Client) Prewarm(url string) error {
+	return c.PrewarmCtx(context.Background(), url)
+}
+
+// PrewarmCtx is like Prewarm but carries ctx through the handshake and payment.
+func (c *Client) PrewarmCtx(ctx context.Context, url string) error {
+	req := &request{method: http.MethodGet, url: url}
+	if err := c.resolveURL(req); err != nil {
+		return err
+	}
+	key := c.keyFor(req)
+	if c.cachedTokenFor(req) != nil {
+		return nil
+	}
+
+	resp, err := c.doRequest(ctx, req, nil)
+	if err != nil {
+		return err
+	}
+	defer discardBody(resp)
+	if !c.isChallenge(resp) {
+		return nil
+	}
+
+	macaroon, invoice, found, err := c.readChallenge(ctx, resp)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("402 response carried no L402 challenge")
+	}
+
+	token, release, err := c.acquirePayment(ctx, key)
+	if err != nil || token != nil {
+		return err
+	}
+	defer release()
+	if _, _, err := c.payChallenge(ctx, req, key, resp.StatusCode, macaroon, invoice); err != nil {
+		return challengeError(resp, err)
+	}
+	return nil
+}
+
+// prewarmWorkers bounds how many URLs PrewarmAll pays for at once.
+const prewarmWorkers = 4
+
+// PrewarmAll prewarms several URLs concurrently, a few at a time, so the
+// payment latency for a known working set is paid once at startup. The
+// returned slice holds the error for each URL, in the order given (nil on
+// success). Budget and spend rate limits apply across the batch as they do
+// to individual payments.
+func (c *Client) PrewarmAll(urls []string) []error {
+	return c.PrewarmAllCtx(context.Background(), urls)
+}
+
+// PrewarmAllCtx is like PrewarmAll but carries ctx through every handshake
+// and payment.
+func (c *Client) PrewarmAllCtx(ctx context.Context, urls []string) []error {
+	errs := make([]error, len(urls))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < prewarmWorkers && w < len(urls); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = c.PrewarmCtx(ctx, urls[i])
+			}
+		}()
+	}
+	for i := range urls {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errs
+}
+
+// Authorize returns the value of an L402 Authorization header for key,
+// paying the challenge in wwwAuthenticate (a WWW-Authenticate header value)
+// unless a valid token is already cached under key. It lets transports other
+// than HTTP (see the satgategrpc package) share the client's wallet, limits,
+// cache and stats. key also stands in for the URL in logs and PaymentInfo.
+// The value is always in the default "LSAT <macaroon>:<preimage>" form;
+// WithAuthFormatter doesn't apply.
+func (c *Client) Authorize(ctx context.Context, key, wwwAuthenticate string) (string, error) {
+	options, err := parseL402Header(wwwAuthenticate)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidL402Header, err)
+	}
+	macaroon, invoice, err := c.selectInvoice(ctx, options)
+	if err != nil {
+		return "", err
+	}
+
+	token, release, err := c.acquirePayment(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if token != nil {
+		return authorization(token.macaroon, token.preimage), nil
+	}
+	defer release()
+
+	req := &request{url: key}
+	preimage, _, err := c.payChallenge(ctx, req, key, http.StatusPaymentRequired, macaroon, invoice)
+	if err != nil {
+		return "", err
+	}
+	return authorization(macaroon, preimage), nil
+}
+
+// CachedAuthorization returns the value of an L402 Authorization header for
+// the token cached under key, if there is one.
+func (c *Client) CachedAuthorization(key string) (string, bool) {
+	token := c.getCachedToken(key)
+	if token == nil {
+		return "", false
+	}
+	return authorization(token.macaroon, token.preimage), true
+}
+
+// request is an outbound request whose body has been encoded exactly once, so
+// the initial attempt and the authenticated retry send identical bytes.
+type request struct {
+	method          string
+	url             string
+	body            []byte
+	contentType     string
+	contentEncoding string      // "gzip" once compressed for WithRequestGzip
+	headers         http.Header // per-call headers
+	freshToken      bool        // skip the cache and pay for a new token
+	maxPaymentSat   int64       // overrides WithMaxPaymentSat if > 0
+	repaid          bool        // a rejected cached token was already replaced
+}
+
+func (req *request) apply(opts []CallOption) {
+	for _, opt := range opts {
+		opt(req)
+	}
+}
+
+// newRequest encodes body (if any) into a replayable request, as JSON unless
+// WithBodyMarshaler says otherwise.
+func (c *Client) newRequest(method, url string, body interface{}) (*request, error) {
+	req := &request{method: method, url: url}
+	if body != nil {
+		marshal := c.bodyMarshaler
+		if marshal == nil {
+			marshal = marshalJSON
+		}
+		data, contentType, err := marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		req.body, req.contentType = data, contentType
+	}
+	return req, nil
+}
+
+// marshalJSON is the default body marshaler.
+func marshalJSON(v interface{}) ([]byte, string, error) {
+	data, err := json.Marshal(v)
+	return data, "application/json", err
+}
+
+// WithBodyMarshaler replaces the JSON encoding of request bodies passed to
+// Post, Put, Do, etc. marshal returns the encoded body and its content type,
+// e.g. to use a faster JSON library or encoder options such as
+// SetEscapeHTML(false). The body is encoded once and replayed on the
+// authenticated retry. Bodies sent with DoRaw are not affected.
+func WithBodyMarshaler(marshal func(v interface{}) ([]byte, string, error)) ClientOption {
+	return func(client *Client) {
+		client.bodyMarshaler = marshal
+	}
+}
+
+func (c *Client) do(ctx context.Context, req *request) (result *Result, err error) {
+	if err := c.resolveURL(req); err != nil {
+		return nil, err
+	}
+	if err := c.compressBody(req); err != nil {
+		return nil, fmt.Errorf("compressing request body: %w", err)
+	}
+
+	if c.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.requestTimeout)
+		defer func() {
+			if result != nil && result.Response != nil {
+				// The deadline covers reading the body too.
+				result.Response.Body = &cancelOnClose{ReadCloser: result.Response.Body, cancel: cancel}
+				return
+			}
+			cancel()
+		}()
+	}
+
+	if c.maxResponseBytes > 0 {
+		defer func() {
+			if result != nil && result.Response != nil {
+				result.Response.Body = &limitedBody{
+					ReadCloser: result.Response.Body,
+					limit:      c.maxResponseBytes,
+					remaining:  c.maxResponseBytes,
+				}
+			}
+		}()
+	}
+
+	ctx, span := c.startSpan(ctx, "satgate.request")
+	span.SetAttribute("http.request.method", req.method)
+	span.SetAttribute("url.full", req.url)
+	defer func() {
+		if result != nil {
+			span.SetAttribute("l402.paid", result.Paid)
+			span.SetAttribute("l402.cache_hit", result.CacheHit)
+			if result.Response != nil {
+				span.SetAttribute("http.response.status_code", result.StatusCode)
+			}
+		}
+		endSpan(span, err)
+	}()
+
 	// Check cache first
-	if token := c.getCachedToken(url); token != nil {
-		if c.verbose {
-			fmt.Printf("⚡ Using cached L402 token for %s\n", url)
+	if !req.freshToken {
+		if token := c.cachedTokenFor(req); token != nil {
+			return c.doCached(ctx, req, token)
+		}
+	}
+
+	// Make initial request
+	resp, err := c.doRequest(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle 402 Payment Required
+	if c.isChallenge(resp) {
+		return c.handlePaymentChallenge(ctx, resp, req)
+	}
+
+	return &Result{Response: resp}, nil
+}
+
+func (c *Client) handlePaymentChallenge(ctx context.Context, resp *http.Response, req *request) (*Result, error) {
+	macaroon, invoice, found, err := c.readChallenge(ctx, resp)
+	if !found || err != nil {
+		return &Result{Response: resp}, err
+	}
+	req = challengedRequest(req, resp)
+
+	// Concurrent requests for the same key share one payment.
+	key := c.keyFor(req)
+	if req.freshToken {
+		c.evictToken(key)
+	}
+	token, release, err := c.acquirePayment(ctx, key)
+	if err != nil {
+		discardBody(resp)
+		return nil, err
+	}
+	if token != nil {
+		discardBody(resp)
+		return c.doCached(ctx, req, token)
+	}
+	preimage, amountSat, err := c.payChallenge(ctx, req, key, resp.StatusCode, macaroon, invoice)
+	release()
+	if err != nil {
+		if errors.Is(err, ErrPreimageMismatch) {
+			// Paid, but the token is unusable: still report the spend.
+			return &Result{Paid: true, AmountSat: amountSat}, challengeError(resp, err)
 		}
-		return c.doWithAuth(method, url, body, token.macaroon, token.preimage)
+		return nil, challengeError(resp, err)
+	}
+	discardBody(resp)
+
+	// From here on the payment has been made, so report it even on error.
+	result := &Result{Paid: true, AmountSat: amountSat}
+
+	// The wallet call can't be interrupted, so honour a cancellation that
+	// arrived while paying before spending more time on the retry.
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	// Retry with L402 token
+	c.logEvent(ctx, slog.LevelDebug, "retrying request with L402 token",
+		"🔄 Retrying request with L402 Token...", "url", req.url)
+	if c.OnRetry != nil {
+		c.OnRetry(req.url, 1)
+	}
+	retryCtx, span := c.startSpan(ctx, "satgate.retry")
+	retryResp, err := c.doWithAuth(retryCtx, req, macaroon, preimage)
+	if err == nil {
+		span.SetAttribute("http.response.status_code", retryResp.StatusCode)
+	}
+	endSpan(span, err)
+	if err != nil {
+		return result, err
+	}
+	c.logEvent(ctx, slog.LevelDebug, "L402 request completed", "",
+		"url", req.url, "cache_hit", false, "status_code", retryResp.StatusCode)
+
+	// Pay at most once per call: a second challenge means the server
+	// rejected the token we just paid for.
+	if c.isChallenge(retryResp) {
+		defer retryResp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(retryResp.Body, maxErrorBodyBytes))
+		return result, fmt.Errorf("%w: server still responded %d: %s",
+			ErrPaymentNotAccepted, retryResp.StatusCode, body)
+	}
+	if message, rejected := preimageRejection(retryResp); rejected {
+		c.evictToken(key)
+		return result, fmt.Errorf("%w: server responded %d: %s",
+			ErrPreimageRejected, retryResp.StatusCode, message)
+	}
+	result.Response = retryResp
+	return result, nil
+}
+
+// preimageRejection reports whether resp, the answer to a request made with
+// a freshly paid token, refuses the token itself: a 401, or a 403 whose
+// challenge or body is about L402. A rejection's body is consumed for the
+// message; otherwise resp is left intact.
+func preimageRejection(resp *http.Response) (message string, rejected bool) {
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return "", false
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	if resp.StatusCode == http.StatusForbidden && !hasL402Challenge(resp) && !mentionsL402(body) {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return "", false
+	}
+	discardBody(resp)
+
+	if message = jsonErrorMessage(body); message == "" {
+		message = strings.Join(strings.Fields(string(body)), " ")
+	}
+	if message == "" || strings.HasPrefix(message, "<") { // empty, or an HTML page
+		message = http.StatusText(resp.StatusCode)
+	}
+	return message, true
+}
+
+// mentionsL402 reports whether an error body talks about the L402 token.
+func mentionsL402(body []byte) bool {
+	text := strings.ToLower(string(body))
+	for _, word := range []string{"l402", "lsat", "macaroon", "preimage"} {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithChallengeOn401 also treats a 401 Unauthorized as a payment challenge
+// when its WWW-Authenticate header carries an L402 or LSAT challenge, for
+// gateways that don't use 402. A 401 with only other schemes (Basic, Bearer,
+// ...) is returned as usual. Off by default.
+func WithChallengeOn401(enabled bool) ClientOption {
+	return func(client *Client) {
+		client.challengeOn401 = enabled
+	}
+}
+
+// isChallenge reports whether resp asks for payment: a 402, or a 401 with an
+// L402 challenge if WithChallengeOn401 is set.
+func (c *Client) isChallenge(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusPaymentRequired:
+		return true
+	case http.StatusUnauthorized:
+		return c.challengeOn401 && hasL402Challenge(resp)
+	}
+	return false
+}
+
+// challengedRequest returns the request that resp, a 402, answers. That is
+// req unless the HTTP client followed redirects to get there, in which case
+// the token is for the final URL: it is paid for, cached and presented there,
+// since the server that issued it may not accept it at the original URL.
+func challengedRequest(req *request, resp *http.Response) *request {
+	if resp.Request == nil || resp.Request.URL.String() == req.url {
+		return req
+	}
+	final := *req
+	final.url = resp.Request.URL.String()
+	if resp.Request.Method != req.method {
+		// A 301-303 redirect turned the request into a GET without a body.
+		final.method, final.body, final.contentType = resp.Request.Method, nil, ""
+	}
+	return &final
+}
+
+// doCached sends req with a cached token.
+func (c *Client) doCached(ctx context.Context, req *request, token *cachedToken) (*Result, error) {
+	if c.proactiveRefresh {
+		c.maybeRefresh(req, token)
+	}
+
+	c.logEvent(ctx, slog.LevelDebug, "using cached L402 token",
+		fmt.Sprintf("⚡ Using cached L402 token for %s", req.url),
+		"url", req.url, "cache_hit", true)
+	resp, err := c.doWithAuth(ctx, req, token.macaroon, token.preimage)
+	if err != nil {
+		return nil, err
+	}
+	c.logEvent(ctx, slog.LevelDebug, "L402 request completed", "",
+		"url", req.url, "cache_hit", true, "status_code", resp.StatusCode)
+
+	// The server no longer accepts the token, e.g. it expired or was revoked
+	// on the server's side: drop it and pay for a new one, once per call.
+	if (resp.StatusCode == http.StatusPaymentRequired || resp.StatusCode == http.StatusUnauthorized) && !req.repaid {
+		req.repaid = true
+		c.logEvent(ctx, slog.LevelInfo, "cached L402 token rejected; paying again",
+			fmt.Sprintf("♻️  Cached token for %s rejected (HTTP %d); paying again", req.url, resp.StatusCode),
+			"url", req.url, "status_code", resp.StatusCode)
+		c.evictCachedToken(token)
+		if !c.isChallenge(resp) {
+			// No new challenge in the rejection: ask for one.
+			discardBody(resp)
+			if resp, err = c.doRequest(ctx, req, nil); err != nil {
+				return nil, err
+			}
+			if !c.isChallenge(resp) {
+				return &Result{Response: resp}, nil
+			}
+		}
+		return c.handlePaymentChallenge(ctx, resp, req)
+	}
+	return &Result{Response: resp, CacheHit: true}, nil
+}
+
+// acquirePayment makes the caller the only one paying for key. If another
+// request is already paying, it waits for that payment and returns the token
+// it cached. Otherwise it returns a nil token and a release func that must be
+// called once the payment has been attempted. If the other payment failed,
+// the waiter takes over and pays itself.
+func (c *Client) acquirePayment(ctx context.Context, key string) (*cachedToken, func(), error) {
+	for {
+		if token := c.getCachedToken(key); token != nil {
+			return token, nil, nil
+		}
+
+		release, busy := c.startPayment(key)
+		if release != nil {
+			return nil, release, nil
+		}
+
+		select {
+		case <-busy:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// inflightPayment marks a payment in flight for a cache key. It is over once
+// every holder has released it.
+type inflightPayment struct {
+	done  chan struct{} // closed when the payment is over
+	holds int
+}
+
+// startPayment registers a payment in flight for key. If there already is
+// one, it returns a channel that is closed when that payment is done;
+// otherwise it returns the release func for the new one.
+func (c *Client) startPayment(key string) (release func(), busy <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if p, ok := c.payments[key]; ok {
+		return nil, p.done
+	}
+	p := &inflightPayment{done: make(chan struct{}), holds: 1}
+	if c.payments == nil {
+		c.payments = make(map[string]*inflightPayment)
+	}
+	c.payments[key] = p
+	return c.releaseFunc(key, p), nil
+}
+
+// holdPayment keeps the payment in flight for key, started by the caller,
+// going past the caller's own release until the returned func is called.
+func (c *Client) holdPayment(key string) (release func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.payments[key]
+	if !ok {
+		return func() {}
+	}
+	p.holds++
+	return c.releaseFunc(key, p)
+}
+
+// releaseFunc returns a func that drops one hold on p, ending the payment
+// once none are left.
+func (c *Client) releaseFunc(key string, p *inflightPayment) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if p.holds--; p.holds == 0 {
+				delete(c.payments, key)
+				close(p.done)
+			}
+		})
+	}
+}
+
+// maxDrainBytes caps how much of an unwanted response body is read so its
+// connection can be reused. Longer bodies are closed unread.
+const maxDrainBytes = 64 << 10
+
+// discardBody drains and closes a response body we won't return, so the
+// connection can be reused.
+func discardBody(resp *http.Response) {
+	io.CopyN(io.Discard, resp.Body, maxDrainBytes)
+	resp.Body.Close()
+}
+
+// cancelOnClose releases a request's context when its response body is
+// closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// maxErrorBodyBytes caps how much of a response body is quoted in an error.
+const maxErrorBodyBytes = 4 << 10
+
+// challengeError wraps err, a failure to pay the challenge in resp, in a
+// ChallengeError carrying the challenge response. It closes resp's body.
+func challengeError(resp *http.Response, err error) error {
+	defer discardBody(resp)
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	return &ChallengeError{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       strings.TrimSpace(string(body)),
+		Err:        err,
+	}
+}
+
+// payChallenge pays the invoice from an L402 challenge issued for req,
+// enforcing spending limits, and caches the resulting token. It returns the
+// verified preimage and the amount paid.
+func (c *Client) payChallenge(ctx context.Context, req *request, key string, statusCode int, macaroon, invoice string) (preimage string, amountSat int64, err error) {
+	ctx, span := c.startSpan(ctx, "satgate.pay")
+	defer func() { endSpan(span, err) }()
+
+	var paymentHash []byte
+	var expiresAt time.Time
+	var keysender KeysendWallet
+	dest, keysendSat, keysend := parseKeysendHint(invoice)
+	if keysend {
+		if keysender = c.keysendWallet(); keysender == nil {
+			return "", 0, ErrKeysendUnsupported
+		}
+		amountSat = keysendSat
+	} else {
+		if isOffer(invoice) {
+			fetched, err := c.fetchOfferInvoice(invoice)
+			if err != nil {
+				return "", 0, err
+			}
+			invoice = fetched
+		}
+
+		// Let a wallet that understands other payment hints (LNURL,
+		// Lightning Address) turn them into a BOLT11 invoice first.
+		if invoice, err = c.resolveInvoice(invoice); err != nil {
+			return "", 0, fmt.Errorf("invalid invoice: %w", err)
+		}
+
+		// Decode the invoice up front: the amount drives spend tracking
+		// and limits, and the payment hash is needed to verify the
+		// preimage. Without an AmountDecoder, an invoice we can't decode
+		// is never paid. A custom AmountDecoder has the final say on the
+		// amount and may accept invoices we can't decode; those are paid
+		// without checking their expiry or the preimage.
+		amountMsat, hash, expiry, decodeErr := decodePaymentRequest(invoice)
+		if c.amountDecoder == nil {
+			if decodeErr != nil {
+				return "", 0, fmt.Errorf("invalid invoice: %w", decodeErr)
+			}
+		} else {
+			if amountMsat, err = c.amountDecoder.DecodeAmountMsat(invoice); err != nil {
+				return "", 0, fmt.Errorf("invalid invoice amount: %w", err)
+			}
+			if amountMsat < 0 {
+				return "", 0, fmt.Errorf("invalid invoice amount: %d msat", amountMsat)
+			}
+		}
+		paymentHash, expiresAt = hash, expiry
+		amountSat = msatToSat(amountMsat)
+	}
+	span.SetAttribute("l402.amount_sat", amountSat)
+
+	c.logEvent(ctx, slog.LevelInfo, "L402 challenge received",
+		fmt.Sprintf("⚡ 402 Detected. Invoice: %s", abbreviate(invoice, 20, 10)),
+		"url", req.url, "status_code", statusCode, "invoice_amount_sat", amountSat)
+	if c.OnChallenge != nil {
+		c.OnChallenge(invoice, amountSat)
+	}
+	// The same invoice again (a server-side retry, say) is already paid:
+	// reuse its preimage rather than paying twice.
+	if preimage, ok := c.recentPreimage(paymentHash); ok {
+		c.logEvent(ctx, slog.LevelInfo, "invoice already paid; reusing preimage",
+			"♻️  Invoice already paid; reusing its preimage", "url", req.url)
+		c.cacheToken(key, req, macaroon, preimage)
+		return preimage, 0, nil
+	}
+
+	if amountSat == 0 {
+		c.logEvent(ctx, slog.LevelWarn, "invoice has no amount; recording 0 sats",
+			"⚠️  Invoice has no amount; recording 0 sats", "url", req.url)
+	}
+
+	if !keysend {
+		if err := c.checkNetwork(invoice); err != nil {
+			return "", 0, err
+		}
+	}
+
+	// Allow for clock skew between us and the invoice issuer.
+	if !expiresAt.IsZero() && c.now().After(expiresAt.Add(c.expirySkew)) {
+		return "", 0, fmt.Errorf("%w: expired at %s", ErrInvoiceExpired, expiresAt.Format(time.RFC3339))
+	}
+
+	maxPaymentSat := c.maxPaymentSat
+	if req.maxPaymentSat > 0 {
+		maxPaymentSat = req.maxPaymentSat
+	}
+	if maxPaymentSat > 0 && amountSat > maxPaymentSat {
+		return "", 0, fmt.Errorf("%w: invoice requests %d sats, limit is %d sats",
+			ErrPaymentTooLarge, amountSat, maxPaymentSat)
+	}
+
+	if c.dryRun {
+		c.logEvent(ctx, slog.LevelInfo, "dry run: skipping payment",
+			fmt.Sprintf("🧪 Dry run: would pay %d sats for %s", amountSat, req.url),
+			"url", req.url, "invoice", invoice, "invoice_amount_sat", amountSat)
+		return "", 0, fmt.Errorf("%w: would pay %d sats (invoice %s)", ErrDryRun, amountSat, invoice)
+	}
+
+	// Called under no lock, so the callback is free to do I/O.
+	if c.approvePayment != nil && !c.approvePayment(invoice, amountSat) {
+		return "", 0, fmt.Errorf("%w: %d sats for %s", ErrPaymentRejected, amountSat, req.url)
+	}
+
+	if err := c.checkBalance(ctx, amountSat); err != nil {
+		return "", 0, err
+	}
+
+	if err := c.takeSpendAllowance(ctx, amountSat); err != nil {
+		return "", 0, err
+	}
+	if err := c.reserveBudget(amountSat); err != nil {
+		c.refundSpendAllowance(amountSat)
+		return "", 0, err
+	}
+
+	// Pay the invoice
+	if err := ctx.Err(); err != nil {
+		c.settleBudget(amountSat, 0, false)
+		c.refundSpendAllowance(amountSat)
+		return "", 0, err
+	}
+	var result PaymentResult
+	if keysend {
+		result, err = c.payWithRetry(ctx, func(context.Context) (PaymentResult, error) {
+			preimage, err := keysender.PayKeysend(dest, amountSat)
+			return PaymentResult{Preimage: preimage}, err
+		})
+	} else {
+		result, err = c.payInvoice(ctx, invoice)
+	}
+
+	var abandoned *abandonedPayment
+	if errors.As(err, &abandoned) {
+		// The wallet may still pay. Until it answers, keep the amount
+		// reserved and key marked in flight, so nobody pays for it again.
+		release := c.holdPayment(key)
+		go func(amountSat int64) {
+			defer release()
+			answer := <-abandoned.answer
+			c.completePayment(c.background, req, key, macaroon, invoice, paymentHash, amountSat, answer.result, answer.err)
+		}(amountSat)
+		return "", 0, fmt.Errorf("%w: %w", ErrPaymentFailed, abandoned.err)
+	}
+	preimage, amountSat, err = c.completePayment(ctx, req, key, macaroon, invoice, paymentHash, amountSat, result, err)
+	if err == nil {
+		span.SetAttribute("l402.preimage_prefix", abbreviate(preimage, 10, 0))
+	}
+	return preimage, amountSat, err
+}
+
+// completePayment settles the budget and rate limit reserved for a payment
+// of amountSat once the wallet has answered with result or err, and on
+// success verifies, caches and records the token.
+func (c *Client) completePayment(ctx context.Context, req *request, key, macaroon, invoice string, paymentHash []byte, amountSat int64, result PaymentResult, err error) (string, int64, error) {
+	preimage := result.Preimage
+	switch {
+	case err != nil && isUnknownOutcome(err):
+		// Freeing the amount could let a payment that does settle
+		// overshoot the limits, so count it as spent.
+		c.recordPendingPayment(amountSat)
+		return "", 0, fmt.Errorf("%w: %w", ErrPaymentFailed, err)
+	case err != nil:
+		c.settleBudget(amountSat, 0, false)
+		c.refundSpendAllowance(amountSat)
+		c.recordPaymentFailure()
+		return "", 0, fmt.Errorf("%w: %w", ErrPaymentFailed, err)
+	}
+	c.settleBudget(amountSat, result.FeeSat, true)
+
+	// Never cache a token the server will reject: the preimage must hash to
+	// the invoice's payment hash. The wallet did pay, so report the amount.
+	// (For keysend, the preimage is the payer's own.)
+	if paymentHash != nil {
+		if err := verifyPreimage(preimage, paymentHash); err != nil {
+			return "", amountSat, err
+		}
+	} else if preimageBytes, err := hex.DecodeString(preimage); err == nil {
+		hash := sha256.Sum256(preimageBytes)
+		paymentHash = hash[:]
+	}
+
+	c.logEvent(ctx, slog.LevelInfo, "L402 payment confirmed",
+		fmt.Sprintf("✅ Payment Confirmed (%d sats). Preimage: %s", amountSat, abbreviate(preimage, 10, 0)),
+		"url", req.url, "invoice_amount_sat", amountSat, "fee_sat", result.FeeSat,
+		"preimage_prefix", abbreviate(preimage, 10, 0))
+
+	// Cache the token
+	c.cacheToken(key, req, macaroon, preimage)
+	c.rememberPayment(paymentHash, preimage)
+
+	info := PaymentInfo{
+		Invoice:     invoice,
+		Preimage:    preimage,
+		PaymentHash: hex.EncodeToString(paymentHash),
+		Macaroon:    macaroon,
+		Endpoint:    req.url,
+		AmountSat:   amountSat,
+		FeeSat:      result.FeeSat,
+		Timestamp:   c.now(),
+	}
+	c.recordPayment(info)
+	if c.OnPayment != nil {
+		c.OnPayment(info)
+	}
+	return preimage, amountSat, nil
+}
+
+// logEvent reports a step of the payment flow. With a logger configured it
+// emits a structured record carrying attrs; otherwise, in verbose mode, it
+// prints line (if any).
+func (c *Client) logEvent(ctx context.Context, level slog.Level, msg, line string, attrs ...any) {
+	if c.logger != nil {
+		c.logger.Log(ctx, level, msg, attrs...)
+		return
+	}
+	if c.verbose && line != "" {
+		fmt.Fprintln(c.verboseOut, line)
+	}
+}
+
+// logAlert reports a problem the user must not miss. It is logged like
+// logEvent, but without a logger line is printed even when verbose output is
+// off, to stderr.
+func (c *Client) logAlert(ctx context.Context, level slog.Level, msg, line string, attrs ...any) {
+	if c.logger != nil {
+		c.logger.Log(ctx, level, msg, attrs...)
+		return
+	}
+	out := c.verboseOut
+	if !c.verbose {
+		out = os.Stderr
+	}
+	fmt.Fprintln(out, line)
+}
+
+// abbreviate shortens s to its first head and last tail characters for
+// logging, e.g. "lnbc2500u1pvjluezs...p9lfyql".
+func abbreviate(s string, head, tail int) string {
+	if len(s) <= head+tail {
+		return s
+	}
+	return s[:head] + "..." + s[len(s)-tail:]
+}
+
+// verifyPreimage checks that preimage (hex) hashes to paymentHash.
+func verifyPreimage(preimage string, paymentHash []byte) error {
+	preimageBytes, err := hex.DecodeString(preimage)
+	if err != nil || len(preimageBytes) != 32 {
+		return fmt.Errorf("%w: wallet returned a malformed preimage", ErrPreimageMismatch)
+	}
+	hash := sha256.Sum256(preimageBytes)
+	if !bytes.Equal(hash[:], paymentHash) {
+		return fmt.Errorf("%w: sha256(preimage) does not equal the invoice payment hash", ErrPreimageMismatch)
+	}
+	return nil
+}
+
+// Stats is a snapshot of a client's payment activity.
+type Stats struct {
+	PaidSat             int64 // total satoshis paid, counted as soon as the wallet pays
+	FeeSat              int64 // routing fees paid on top of PaidSat (see DetailedWallet)
+	PaymentCount        int64 // invoices paid successfully
+	FailedPaymentCount  int64 // invoices the wallet failed to pay
+	PendingPaymentCount int64 // payments of unknown outcome, counted in PaidSat
+	CacheHitCount       int64 // requests served with a cached token
+}
+
+// Stats returns the client's payment statistics since it was created or
+// since the last ResetStats.
+func (c *Client) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// PaidSat returns the total satoshis paid by this client since it was
+// created or since the last ResetStats.
+func (c *Client) PaidSat() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats.PaidSat
+}
+
+// ResetStats zeroes the client's payment statistics. Since the spend budget
+// set by WithMaxBudgetSat is measured against PaidSat, this also starts a
+// fresh budget period.
+func (c *Client) ResetStats() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats = Stats{}
+}
+
+// reserveBudget checks amountSat against the spend budget and, if it fits,
+// holds it until settleBudget is called. Reserving under c.mu keeps
+// concurrent payments from jointly overshooting the limit.
+func (c *Client) reserveBudget(amountSat int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxBudgetSat > 0 && c.stats.PaidSat+c.pendingSat+amountSat > c.maxBudgetSat {
+		return fmt.Errorf("%w: paying %d sats would exceed the %d sat budget (%d sats spent)",
+			ErrBudgetExceeded, amountSat, c.maxBudgetSat, c.stats.PaidSat)
+	}
+	c.pendingSat += amountSat
+	return nil
+}
+
+// settleBudget releases a reservation made by reserveBudget, recording the
+// amount and fee as spent if the payment went through.
+func (c *Client) settleBudget(amountSat, feeSat int64, paid bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pendingSat -= amountSat
+	if paid {
+		c.stats.PaidSat += amountSat
+		c.stats.FeeSat += feeSat
+		c.stats.PaymentCount++
+	}
+}
+
+// recordPendingPayment settles the reservation for a payment whose outcome
+// is unknown (see ErrPaymentPending) by counting it as spent.
+func (c *Client) recordPendingPayment(amountSat int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pendingSat -= amountSat
+	c.stats.PaidSat += amountSat
+	c.stats.PendingPaymentCount++
+}
+
+// checkBalance fails with ErrInsufficientBalance if preflight balance checks
+// are enabled and the wallet reports less than amountSat. A wallet that can't
+// report its balance, or fails to, doesn't block the payment.
+func (c *Client) checkBalance(ctx context.Context, amountSat int64) error {
+	if !c.preflightBalance {
+		return nil
+	}
+	checker, ok := c.wallet.(BalanceChecker)
+	if !ok {
+		return nil
+	}
+
+	balance, err := checker.Balance()
+	if err != nil {
+		c.logEvent(ctx, slog.LevelWarn, "wallet balance check failed; paying anyway",
+			fmt.Sprintf("⚠️  Balance check failed (%v); paying anyway", err), "error", err)
+		return nil
+	}
+	if balance < amountSat {
+		return fmt.Errorf("%w: invoice requests %d sats, wallet holds %d sats",
+			ErrInsufficientBalance, amountSat, balance)
+	}
+	return nil
+}
+
+// recordPaymentFailure counts a payment the wallet failed to make.
+func (c *Client) recordPaymentFailure() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.FailedPaymentCount++
+}
+
+func (c *Client) doWithAuth(ctx context.Context, req *request, macaroon, preimage string) (*http.Response, error) {
+	var headers http.Header
+	if c.authFormatter != nil {
+		headers = c.authFormatter(macaroon, preimage)
+	} else {
+		headers = http.Header{"Authorization": {authorization(macaroon, preimage)}}
+	}
+	if c.preimageHeader != "" {
+		headers = headers.Clone() // the formatter's map may be shared
+		if headers == nil {
+			headers = make(http.Header)
+		}
+		headers.Set(c.preimageHeader, preimage)
+	}
+	return c.doRequest(ctx, req, headers)
+}
+
+// authorization returns the Authorization header value for an L402 token.
+func authorization(macaroon, preimage string) string {
+	return fmt.Sprintf("LSAT %s:%s", macaroon, preimage)
+}
+
+func (c *Client) doRequest(ctx context.Context, req *request, headers http.Header) (*http.Response, error) {
+	// A fresh reader over the stored bytes on every attempt means a retry can
+	// never observe a body already drained by the first request.
+	var bodyReader io.Reader
+	if req.body != nil {
+		bodyReader = bytes.NewReader(req.body)
 	}
 
-	// Make initial request
-	resp, err := c.doRequest(method, url, body, nil)
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, req.url, bodyReader)
 	if err != nil {
 		return nil, err
 	}
 
-	// Handle 402 Payment Required
-	if resp.StatusCode == http.StatusPaymentRequired {
-		return c.handlePaymentChallenge(resp, method, url, body)
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
 	}
-
-	return resp, nil
-}
-
-func (c *Client) handlePaymentChallenge(resp *http.Response, method, url string, body interface{}) (*http.Response, error) {
-	authHeader := resp.Header.Get("WWW-Authenticate")
-	if authHeader == "" {
-		return resp, nil
+	if req.contentEncoding != "" {
+		httpReq.Header.Set("Content-Encoding", req.contentEncoding)
 	}
+	httpReq.Header.Set("User-Agent", c.userAgent)
 
-	// Parse L402/LSAT header
-	macaroon, invoice := parseL402Header(authHeader)
-	if macaroon == "" || invoice == "" {
-		return resp, fmt.Errorf("invalid L402 header format")
+	// Precedence, lowest first: client defaults, per-call headers, then the
+	// headers of this attempt (the L402 Authorization on a paid retry).
+	for k, v := range c.defaultHeaders {
+		httpReq.Header.Set(k, v)
+	}
+	for k, v := range req.headers {
+		httpReq.Header[k] = v
+	}
+	for k, v := range headers {
+		httpReq.Header[http.CanonicalHeaderKey(k)] = v
 	}
 
-	if c.verbose {
-		fmt.Printf("⚡ 402 Detected. Invoice: %s...%s\n", invoice[:20], invoice[len(invoice)-10:])
+	if c.requestHook != nil {
+		if err := c.requestHook(httpReq); err != nil {
+			return nil, fmt.Errorf("request hook: %w", err)
+		}
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err == nil && c.responseHook != nil {
+		if err := c.responseHook(resp); err != nil {
+			discardBody(resp)
+			return nil, fmt.Errorf("response hook: %w", err)
+		}
 	}
+	return resp, err
+}
 
-	// Pay the invoice
-	preimage, err := c.wallet.PayInvoice(invoice)
+// resolveURL resolves req.url against the base URL, if one is set.
+func (c *Client) resolveURL(req *request) error {
+	if c.baseURL == "" {
+		return nil
+	}
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL: %w", err)
+	}
+	ref, err := url.Parse(req.url)
 	if err != nil {
-		return nil, fmt.Errorf("payment failed: %w", err)
+		return err
 	}
+	req.url = base.ResolveReference(ref).String()
+	return nil
+}
 
-	if c.verbose {
-		fmt.Printf("✅ Payment Confirmed. Preimage: %s...\n", preimage[:10])
+// keyFor returns the token cache key for req.
+func (c *Client) keyFor(req *request) string {
+	if c.cacheKey != nil {
+		return c.cacheKey(req.method, req.url)
 	}
+	return req.url
+}
 
-	// Cache the token
-	c.cacheToken(url, macaroon, preimage)
+func (c *Client) getCachedToken(key string) *cachedToken {
+	c.cache.mu.RLock()
+	token, ok := c.cache.tokens[key]
+	c.cache.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+	if c.now().After(token.expiresAt) {
+		// Evict lazily, unless the entry was replaced in the meantime.
+		c.cache.mu.Lock()
+		if c.cache.tokens[key] == token {
+			c.cache.remove(key)
+		}
+		c.cache.mu.Unlock()
+		return nil
+	}
+	c.cache.touch(key, token)
 
-	// Track payment
 	c.mu.Lock()
-	c.TotalPaidSat++ // Simplified; ideally decode invoice for amount
+	c.stats.CacheHitCount++
 	c.mu.Unlock()
+	return token
+}
 
-	if c.OnPayment != nil {
-		c.OnPayment(PaymentInfo{
-			Invoice:   invoice,
-			Preimage:  preimage,
-			Macaroon:  macaroon,
-			Endpoint:  url,
-			Timestamp: time.Now(),
-		})
-	}
-
-	// Retry with L402 token
-	if c.verbose {
-		fmt.Println("🔄 Retrying request with L402 Token...")
+// evictCachedToken drops token from the cache, unless it has already been
+// replaced.
+func (c *Client) evictCachedToken(token *cachedToken) {
+	c.cache.mu.Lock()
+	if c.cache.tokens[token.key] == token {
+		c.cache.remove(token.key)
 	}
-	return c.doWithAuth(method, url, body, macaroon, preimage)
+	c.cache.mu.Unlock()
 }
 
-func (c *Client) doWithAuth(method, url string, body interface{}, macaroon, preimage string) (*http.Response, error) {
-	authValue := fmt.Sprintf("LSAT %s:%s", macaroon, preimage)
-	return c.doRequest(method, url, body, map[string]string{"Authorization": authValue})
+// evictToken drops the token cached under key, if any.
+func (c *Client) evictToken(key string) {
+	c.cache.mu.Lock()
+	c.cache.remove(key)
+	c.cache.mu.Unlock()
 }
 
-func (c *Client) doRequest(method, url string, body interface{}, headers map[string]string) (*http.Response, error) {
-	var bodyReader io.Reader
-	if body != nil {
-		jsonBody, err := json.Marshal(body)
-		if err != nil {
-			return nil, err
-		}
-		bodyReader = bytes.NewReader(jsonBody)
+// cacheToken caches a token paid for by req under key. If its macaroon
+// scopes it to more URLs, it is also served for those.
+func (c *Client) cacheToken(key string, req *request, macaroon, preimage string) {
+	if c.cacheTTL <= 0 {
+		return // caching disabled
 	}
 
-	req, err := http.NewRequest(method, url, bodyReader)
-	if err != nil {
-		return nil, err
+	// Honour an expiry caveat in the macaroon when it is sooner than our
+	// TTL, so we never present a token the server already considers expired.
+	expiresAt := c.now().Add(c.jitteredTTL())
+	if macaroonExpiresAt, ok := macaroonExpiry(macaroon); ok && macaroonExpiresAt.Before(expiresAt) {
+		expiresAt = macaroonExpiresAt
 	}
 
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+	c.cache.mu.Lock()
+	c.cache.put(key, &cachedToken{
+		macaroon:  macaroon,
+		preimage:  preimage,
+		expiresAt: expiresAt,
+	})
+	if prefix, ok := macaroonScope(macaroon, req.url); ok {
+		if c.cache.scopes == nil {
+			c.cache.scopes = make(map[string]tokenScope)
+		}
+		c.cache.scopes[key] = tokenScope{prefix: prefix, method: req.method}
 	}
+	c.cache.mu.Unlock()
 
-	for k, v := range headers {
-		req.Header.Set(k, v)
+	if c.cacheStore != nil {
+		c.saveCache()
 	}
-
-	return c.httpClient.Do(req)
 }
 
-func (c *Client) getCachedToken(url string) *cachedToken {
-	c.cache.mu.RLock()
-	defer c.cache.mu.RUnlock()
+// jitteredTTL returns the cache TTL spread randomly by up to ±ttlJitter.
+func (c *Client) jitteredTTL() time.Duration {
+	if c.ttlJitter <= 0 {
+		return c.cacheTTL
+	}
+	jitter := c.ttlJitter * (2*rand.Float64() - 1)
+	return c.cacheTTL + time.Duration(float64(c.cacheTTL)*jitter)
+}
 
-	token, ok := c.cache.tokens[url]
-	if !ok || time.Now().After(token.expiresAt) {
-		return nil
+// sweepCache removes expired tokens from the cache every interval until
+// stop is closed.
+func (c *Client) sweepCache(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := c.now()
+			c.cache.mu.Lock()
+			for key, token := range c.cache.tokens {
+				if now.After(token.expiresAt) {
+					c.cache.remove(key)
+				}
+			}
+			c.cache.mu.Unlock()
+		case <-stop:
+			return
+		}
 	}
-	return token
 }
 
-func (c *Client) cacheToken(url, macaroon, preimage string) {
+// loadCache fills the cache from cacheStore, skipping expired tokens. Tokens
+// that can't be decrypted turn persistence off, so that a client with the
+// wrong key doesn't overwrite them.
+func (c *Client) loadCache() {
+	stored, err := c.cacheStore.Load()
+	if err != nil {
+		c.logEvent(context.Background(), slog.LevelWarn, "could not load token cache",
+			fmt.Sprintf("⚠️  Could not load token cache: %v", err), "error", err)
+		return
+	}
+
+	now := c.now()
+	tokens := make([]StoredToken, 0, len(stored))
+	for _, t := range stored {
+		if !now.Before(t.ExpiresAt) {
+			continue
+		}
+		t, err := c.openToken(t)
+		if err != nil {
+			c.disableCacheStore(err)
+			return
+		}
+		tokens = append(tokens, t)
+	}
+
 	c.cache.mu.Lock()
 	defer c.cache.mu.Unlock()
 
-	c.cache.tokens[url] = &cachedToken{
-		macaroon:  macaroon,
-		preimage:  preimage,
-		expiresAt: time.Now().Add(c.cacheTTL),
+	for _, t := range tokens {
+		c.cache.put(t.Key, &cachedToken{
+			macaroon:  t.Macaroon,
+			preimage:  t.Preimage,
+			expiresAt: t.ExpiresAt,
+		})
 	}
 }
 
-// parseL402Header extracts macaroon and invoice from WWW-Authenticate header.
-func parseL402Header(header string) (macaroon, invoice string) {
-	macaroonRe := regexp.MustCompile(`macaroon="([^"]+)"`)
-	invoiceRe := regexp.MustCompile(`invoice="([^"]+)"`)
+// disableCacheStore stops persisting tokens after err, reporting it loudly:
+// the client keeps working, but every token it pays for is lost on exit.
+func (c *Client) disableCacheStore(err error) {
+	c.logAlert(context.Background(), slog.LevelError, "token cache unusable; tokens will not be persisted",
+		fmt.Sprintf("❌ Token cache unusable (%v); tokens will not be persisted", err), "error", err)
+	c.cacheStore = nil
+	c.cacheStoreErr = err
+}
+
+// CacheStoreErr returns the error that made the client stop persisting
+// tokens, or nil if the store set with WithCacheStore is in use (or none was
+// set). It is decided when the client is created, so check it right after
+// NewClient: errors.Is(err, ErrTokenCacheKey) means the key set with
+// WithTokenEncryptionKey is invalid or doesn't match the stored tokens.
+func (c *Client) CacheStoreErr() error {
+	return c.cacheStoreErr
+}
+
+// saveCache writes the unexpired tokens to cacheStore.
+func (c *Client) saveCache() {
+	c.storeMu.Lock()
+	defer c.storeMu.Unlock()
 
-	if m := macaroonRe.FindStringSubmatch(header); len(m) > 1 {
-		macaroon = m[1]
+	now := c.now()
+	c.cache.mu.RLock()
+	tokens := make([]StoredToken, 0, len(c.cache.tokens))
+	for key, t := range c.cache.tokens {
+		if now.Before(t.expiresAt) {
+			tokens = append(tokens, StoredToken{
+				Key:       key,
+				Macaroon:  t.macaroon,
+				Preimage:  t.preimage,
+				ExpiresAt: t.expiresAt,
+			})
+		}
+	}
+	c.cache.mu.RUnlock()
+
+	for i := range tokens {
+		var err error
+		if tokens[i], err = c.sealToken(tokens[i]); err != nil {
+			c.logEvent(context.Background(), slog.LevelWarn, "could not encrypt token cache",
+				fmt.Sprintf("⚠️  Could not encrypt token cache: %v", err), "error", err)
+			return
+		}
 	}
-	if m := invoiceRe.FindStringSubmatch(header); len(m) > 1 {
-		invoice = m[1]
+
+	if err := c.cacheStore.Save(tokens); err != nil {
+		c.logEvent(context.Background(), slog.LevelWarn, "could not save token cache",
+			fmt.Sprintf("⚠️  Could not save token cache: %v", err), "error", err)
 	}
-	return
 }
 
 // ============================================================================
@@ -276,7 +2035,7 @@ func parseL402Header(header string) (macaroon, invoice string) {
 type LNBitsWallet struct {
 	BaseURL  string
 	AdminKey string
-	client   *http.Client
+	client   *walletClient
 }
 
 // NewLNBitsWallet creates a new LNBits wallet.
@@ -284,12 +2043,29 @@ func NewLNBitsWallet(baseURL, adminKey string) *LNBitsWallet {
 	return &LNBitsWallet{
 		BaseURL:  baseURL,
 		AdminKey: adminKey,
-		client:   &http.Client{Timeout: 30 * time.Second},
+		client:   newWalletClient(30 * time.Second),
 	}
 }
 
 // PayInvoice pays a BOLT11 invoice via LNBits.
 func (w *LNBitsWallet) PayInvoice(invoice string) (string, error) {
+	return w.PayInvoiceCtx(context.Background(), invoice)
+}
+
+// PayInvoiceCtx is PayInvoice, abandoning the API call (or waiting for the
+// payment to settle) once ctx is done.
+func (w *LNBitsWallet) PayInvoiceCtx(ctx context.Context, invoice string) (string, error) {
+	result, err := w.payInvoiceDetailed(ctx, invoice)
+	return result.Preimage, err
+}
+
+// PayInvoiceDetailed pays a BOLT11 invoice via LNBits and reports the
+// routing fee.
+func (w *LNBitsWallet) PayInvoiceDetailed(invoice string) (PaymentResult, error) {
+	return w.payInvoiceDetailed(context.Background(), invoice)
+}
+
+func (w *LNBitsWallet) payInvoiceDetailed(ctx context.Context, invoice string) (PaymentResult, error) {
 	payload := map[string]interface{}{
 		"out":    true,
 		"bolt11": invoice,
@@ -297,12 +2073,12 @@ func (w *LNBitsWallet) PayInvoice(invoice string) (string, error) {
 
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		return "", err
+		return PaymentResult{}, err
 	}
 
-	req, err := http.NewRequest("POST", w.BaseURL+"/api/v1/payments", bytes.NewReader(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", w.BaseURL+"/api/v1/payments", bytes.NewReader(jsonPayload))
 	if err != nil {
-		return "", err
+		return PaymentResult{}, err
 	}
 
 	req.Header.Set("X-Api-Key", w.AdminKey)
@@ -310,29 +2086,89 @@ func (w *LNBitsWallet) PayInvoice(invoice string) (string, error) {
 
 	resp, err := w.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("LNBits API error: %w", err)
+		return PaymentResult{}, payCallError(walletRequestError("LNBits", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("LNBits payment failed: %s", string(body))
+		return PaymentResult{}, walletStatusError("LNBits", resp)
 	}
 
 	var result struct {
 		PaymentHash string `json:"payment_hash"`
 		Preimage    string `json:"preimage"`
+		Status      string `json:"status"`
+		FeeMsat     *int64 `json:"fee"` // negative; only in newer versions
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+		return PaymentResult{}, err
+	}
+
+	if !isZeroPreimage(result.Preimage) && result.Status != "pending" {
+		paid := PaymentResult{Preimage: result.Preimage}
+		if result.FeeMsat != nil {
+			paid.FeeSat = feeSatFromMsat(*result.FeeMsat)
+		} else if status, err := w.paymentStatus(ctx, result.PaymentHash); err == nil {
+			// Older versions only report the fee on the payment record.
+			paid.FeeSat = status.FeeSat
+		}
+		return paid, nil
+	}
+	if result.PaymentHash == "" {
+		return PaymentResult{}, fmt.Errorf("LNBits: %w", ErrNoPreimage)
+	}
+
+	// Accepted but still in flight: wait for it to settle.
+	var feeSat int64
+	preimage, err := awaitSettlement(ctx, "LNBits", w.client.timeout(), func() (string, error) {
+		status, err := w.paymentStatus(ctx, result.PaymentHash)
+		feeSat = status.FeeSat
+		return status.Preimage, err
+	})
+	return PaymentResult{Preimage: preimage, FeeSat: feeSat}, err
+}
+
+// paymentStatus looks up an outgoing payment, returning its preimage and fee
+// once it has settled, or no preimage while it is pending.
+func (w *LNBitsWallet) paymentStatus(ctx context.Context, paymentHash string) (PaymentResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", w.BaseURL+"/api/v1/payments/"+paymentHash, nil)
+	if err != nil {
+		return PaymentResult{}, err
+	}
+	req.Header.Set("X-Api-Key", w.AdminKey)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return PaymentResult{}, payCallError(walletRequestError("LNBits", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return PaymentResult{}, walletStatusError("LNBits", resp)
 	}
 
-	if result.Preimage == "" {
-		return "", fmt.Errorf("LNBits did not return preimage")
+	var status struct {
+		Paid     bool   `json:"paid"`
+		Preimage string `json:"preimage"`
+		Details  struct {
+			Status  string `json:"status"`
+			FeeMsat int64  `json:"fee"`
+		} `json:"details"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return PaymentResult{}, err
 	}
 
-	return result.Preimage, nil
+	switch {
+	case status.Details.Status == "failed":
+		return PaymentResult{}, errors.New("payment failed")
+	case status.Paid && !isZeroPreimage(status.Preimage):
+		return PaymentResult{Preimage: status.Preimage, FeeSat: feeSatFromMsat(status.Details.FeeMsat)}, nil
+	case status.Paid:
+		return PaymentResult{}, ErrNoPreimage
+	}
+	return PaymentResult{}, nil
 }
 
 // ============================================================================
@@ -342,25 +2178,42 @@ func (w *LNBitsWallet) PayInvoice(invoice string) (string, error) {
 // AlbyWallet implements LightningWallet using Alby API.
 type AlbyWallet struct {
 	AccessToken string
-	client      *http.Client
+	client      *walletClient
 }
 
 // NewAlbyWallet creates a new Alby wallet.
 func NewAlbyWallet(accessToken string) *AlbyWallet {
 	return &AlbyWallet{
 		AccessToken: accessToken,
-		client:      &http.Client{Timeout: 30 * time.Second},
+		client:      newWalletClient(30 * time.Second),
 	}
 }
 
 // PayInvoice pays a BOLT11 invoice via Alby API.
 func (w *AlbyWallet) PayInvoice(invoice string) (string, error) {
+	return w.PayInvoiceCtx(context.Background(), invoice)
+}
+
+// PayInvoiceCtx is PayInvoice, abandoning the API call (or waiting for the
+// payment to settle) once ctx is done.
+func (w *AlbyWallet) PayInvoiceCtx(ctx context.Context, invoice string) (string, error) {
+	result, err := w.payInvoiceDetailed(ctx, invoice)
+	return result.Preimage, err
+}
+
+// PayInvoiceDetailed pays a BOLT11 invoice via Alby API and reports the
+// routing fee.
+func (w *AlbyWallet) PayInvoiceDetailed(invoice string) (PaymentResult, error) {
+	return w.payInvoiceDetailed(context.Background(), invoice)
+}
+
+func (w *AlbyWallet) payInvoiceDetailed(ctx context.Context, invoice string) (PaymentResult, error) {
 	payload := map[string]string{"invoice": invoice}
 	jsonPayload, _ := json.Marshal(payload)
 
-	req, err := http.NewRequest("POST", "https://api.getalby.com/payments", bytes.NewReader(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.getalby.com/payments", bytes.NewReader(jsonPayload))
 	if err != nil {
-		return "", err
+		return PaymentResult{}, err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+w.AccessToken)
@@ -368,28 +2221,120 @@ func (w *AlbyWallet) PayInvoice(invoice string) (string, error) {
 
 	resp, err := w.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("Alby API error: %w", err)
+		return PaymentResult{}, payCallError(walletRequestError("Alby", err))
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Alby payment failed: %s", string(body))
+	// 202 Accepted: the payment is in flight and settles asynchronously.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
+		return PaymentResult{}, walletStatusError("Alby", resp)
 	}
 
 	var result struct {
+		Preimage        string `json:"preimage"`
+		PaymentPreimage string `json:"payment_preimage"`
+		PaymentHash     string `json:"payment_hash"`
+		Fee             int64  `json:"fee"` // sats
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return PaymentResult{}, err
+	}
+
+	preimage := result.Preimage
+	if isZeroPreimage(preimage) {
+		preimage = result.PaymentPreimage
+	}
+	if !isZeroPreimage(preimage) {
+		return PaymentResult{Preimage: preimage, FeeSat: result.Fee}, nil
+	}
+	if result.PaymentHash == "" {
+		return PaymentResult{}, fmt.Errorf("Alby: %w", ErrNoPreimage)
+	}
+
+	// Accepted but not settled yet: wait for it.
+	var feeSat int64
+	preimage, err = awaitSettlement(ctx, "Alby", w.client.timeout(), func() (string, error) {
+		status, err := w.paymentStatus(ctx, result.PaymentHash)
+		feeSat = status.FeeSat
+		return status.Preimage, err
+	})
+	return PaymentResult{Preimage: preimage, FeeSat: feeSat}, err
+}
+
+// paymentStatus looks up a payment by its hash, returning its preimage and
+// fee once it has settled, or no preimage while it is pending.
+func (w *AlbyWallet) paymentStatus(ctx context.Context, paymentHash string) (PaymentResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.getalby.com/invoices/"+paymentHash, nil)
+	if err != nil {
+		return PaymentResult{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+w.AccessToken)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return PaymentResult{}, payCallError(walletRequestError("Alby", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return PaymentResult{}, walletStatusError("Alby", resp)
+	}
+
+	var status struct {
+		Settled  bool   `json:"settled"`
 		Preimage string `json:"preimage"`
+		State    string `json:"state"`
+		FeesPaid int64  `json:"fees_paid"` // sats
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return PaymentResult{}, err
+	}
+
+	switch {
+	case strings.EqualFold(status.State, "FAILED") || strings.EqualFold(status.State, "ERROR"):
+		return PaymentResult{}, errors.New("payment failed")
+	case status.Settled && !isZeroPreimage(status.Preimage):
+		return PaymentResult{Preimage: status.Preimage, FeeSat: status.FeesPaid}, nil
+	case status.Settled:
+		return PaymentResult{}, ErrNoPreimage
+	}
+	return PaymentResult{}, nil
+}
+
+// Balance returns the wallet's spendable balance in satoshis.
+func (w *AlbyWallet) Balance() (int64, error) {
+	req, err := http.NewRequest("GET", "https://api.getalby.com/balance", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+w.AccessToken)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("Alby API error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, newWalletError("Alby", resp)
+	}
+
+	var result struct {
+		Balance int64  `json:"balance"`
+		Unit    string `json:"unit"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+		return 0, err
 	}
 
-	if result.Preimage == "" {
-		return "", fmt.Errorf("Alby did not return preimage")
+	if result.Unit != "" && result.Unit != "sat" {
+		return 0, fmt.Errorf("Alby returned balance in unexpected unit %q", result.Unit)
 	}
 
-	return result.Preimage, nil
+	return result.Balance, nil
 }
 
 // ============================================================================
@@ -398,10 +2343,31 @@ func (w *AlbyWallet) PayInvoice(invoice string) (string, error) {
 
 // LNDWallet implements LightningWallet using LND's REST API.
 type LNDWallet struct {
-	Host       string // e.g., "localhost:8080"
-	Macaroon   string // hex-encoded admin macaroon
-	TLSCert    []byte // TLS certificate (optional for local)
-	client     *http.Client
+	Host     string // e.g., "localhost:8080"
+	Macaroon string // hex-encoded admin macaroon
+	TLSCert  []byte // TLS certificate, PEM or DER (optional; trusted in addition to system roots)
+
+	// InsecureSkipVerify disables TLS certificate verification entirely.
+	// It exists for local development against a node whose certificate you
+	// can't easily load; never enable it for a node reached over a network
+	// you don't control. Prefer TLSCert.
+	InsecureSkipVerify bool
+
+	// FeeLimitSat caps the routing fee of a payment. If zero, the cap is 5%
+	// of the amount, but at least 10 sats.
+	FeeLimitSat int64
+
+	// MaxParts caps how many parts a payment may be split into (multi-part
+	// payments), so that invoices larger than any one channel can carry
+	// still get paid. If zero, up to 16 parts are used; 1 disables
+	// splitting. Nodes without /v2/router/send pay along a single path.
+	MaxParts int
+
+	mu        sync.Mutex   // guards the fields below
+	client    *http.Client // built on first use; nil again after a setting changes
+	clientErr error
+	timeout   time.Duration // API timeout, 60s if zero
+	proxy     proxyFunc
 }
 
 // NewLNDWallet creates a new LND wallet.
@@ -409,62 +2375,340 @@ func NewLNDWallet(host, macaroonHex string) *LNDWallet {
 	return &LNDWallet{
 		Host:     host,
 		Macaroon: macaroonHex,
-		client:   &http.Client{Timeout: 60 * time.Second},
 	}
 }
 
+// NewLNDWalletWithCert creates a new LND wallet that trusts the node's TLS
+// certificate (typically the contents of lnd's tls.cert), as needed for
+// LND's default self-signed certificate.
+func NewLNDWalletWithCert(host, macaroonHex string, tlsCert []byte) *LNDWallet {
+	w := NewLNDWallet(host, macaroonHex)
+	w.TLSCert = tlsCert
+	return w
+}
+
+// httpClient builds the wallet's HTTP client on first use so that TLSCert and
+// InsecureSkipVerify set after construction still take effect. Settings
+// changed through configure make it build a new one.
+func (w *LNDWallet) httpClient() (*http.Client, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.client == nil && w.clientErr == nil {
+		tlsConfig := &tls.Config{InsecureSkipVerify: w.InsecureSkipVerify}
+
+		if len(w.TLSCert) > 0 {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(w.TLSCert) {
+				cert, err := x509.ParseCertificate(w.TLSCert)
+				if err != nil {
+					w.clientErr = fmt.Errorf("invalid LND TLS certificate: %w", err)
+					return nil, w.clientErr
+				}
+				pool.AddCert(cert)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		if w.proxy != nil {
+			transport.Proxy = w.proxy
+		}
+		timeout := w.timeout
+		if timeout == 0 {
+			timeout = 60 * time.Second
+		}
+		w.client = &http.Client{Timeout: timeout, Transport: transport}
+	}
+	return w.client, w.clientErr
+}
+
+// configure changes the wallet's settings with fn and drops the current HTTP
+// client, so that calls made from then on use a client built with the new
+// settings. Calls already in progress keep the old one.
+func (w *LNDWallet) configure(fn func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fn()
+	if w.client != nil {
+		w.client.CloseIdleConnections()
+	}
+	w.client, w.clientErr = nil, nil
+}
+
+// Close closes the wallet's idle connections to the node.
+func (w *LNDWallet) Close() error {
+	if client, err := w.httpClient(); err == nil {
+		client.CloseIdleConnections()
+	}
+	return nil
+}
+
 // PayInvoice pays a BOLT11 invoice via LND REST API.
 func (w *LNDWallet) PayInvoice(invoice string) (string, error) {
-	payload := map[string]string{"payment_request": invoice}
+	return w.PayInvoiceCtx(context.Background(), invoice)
+}
+
+// PayInvoiceCtx is PayInvoice, abandoning the API call once ctx is done.
+// LND keeps trying to route a payment it has started regardless.
+func (w *LNDWallet) PayInvoiceCtx(ctx context.Context, invoice string) (string, error) {
+	result, err := w.payInvoiceDetailed(ctx, invoice)
+	return result.Preimage, err
+}
+
+// PayInvoiceDetailed pays a BOLT11 invoice via LND REST API and reports the
+// routing fee.
+func (w *LNDWallet) PayInvoiceDetailed(invoice string) (PaymentResult, error) {
+	return w.payInvoiceDetailed(context.Background(), invoice)
+}
+
+func (w *LNDWallet) payInvoiceDetailed(ctx context.Context, invoice string) (PaymentResult, error) {
+	return w.sendPayment(ctx, map[string]interface{}{"payment_request": invoice})
+}
+
+// sendPayment makes a payment with the router's streaming /v2/router/send,
+// falling back to the legacy /v1/channels/transactions on nodes (or REST
+// proxies) that don't serve it.
+func (w *LNDWallet) sendPayment(ctx context.Context, payload map[string]interface{}) (PaymentResult, error) {
+	result, err := w.sendPaymentV2(ctx, payload)
+	var walletErr *WalletError
+	if errors.As(err, &walletErr) &&
+		(walletErr.StatusCode == http.StatusNotFound || walletErr.StatusCode == http.StatusNotImplemented) {
+		return w.sendPaymentV1(ctx, payload)
+	}
+	return result, err
+}
+
+// sendPaymentV2 pays via /v2/router/send, which streams the payment's state
+// as it progresses, and returns the preimage and fee from the final
+// SUCCEEDED update.
+func (w *LNDWallet) sendPaymentV2(ctx context.Context, payload map[string]interface{}) (PaymentResult, error) {
+	client, err := w.httpClient()
+	if err != nil {
+		return PaymentResult{}, err
+	}
+
+	// Have LND give up a little before our own API timeout does, so a
+	// payment that can't complete ends with a clear FAILED update.
+	timeoutSeconds := int(client.Timeout.Seconds()) - 5
+	if timeoutSeconds < 1 {
+		timeoutSeconds = 1
+	}
+	v2 := map[string]interface{}{
+		"timeout_seconds":     timeoutSeconds,
+		"fee_limit_sat":       strconv.FormatInt(w.feeLimitSat(payload), 10),
+		"max_parts":           w.maxParts(),
+		"no_inflight_updates": true,
+	}
+	for k, v := range payload {
+		v2[k] = v
+	}
+	jsonPayload, _ := json.Marshal(v2)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("https://%s/v2/router/send", w.Host), bytes.NewReader(jsonPayload))
+	if err != nil {
+		return PaymentResult{}, err
+	}
+	if _, err := hex.DecodeString(w.Macaroon); err != nil {
+		return PaymentResult{}, fmt.Errorf("invalid macaroon hex: %w", err)
+	}
+	req.Header.Set("Grpc-Metadata-macaroon", w.Macaroon)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return PaymentResult{}, payCallError(walletRequestError("LND", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return PaymentResult{}, walletStatusError("LND", resp)
+	}
+
+	// The body is a stream of JSON objects, one per payment update.
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var update struct {
+			Result struct {
+				Status          string `json:"status"`
+				PaymentPreimage string `json:"payment_preimage"`
+				FeeMsat         int64  `json:"fee_msat,string"`
+				FailureReason   string `json:"failure_reason"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := decoder.Decode(&update); err != nil {
+			if err == io.EOF {
+				return PaymentResult{}, errors.New("LND payment stream ended before the payment completed")
+			}
+			return PaymentResult{}, payCallError(walletRequestError("LND", err))
+		}
+
+		switch {
+		case update.Error != nil:
+			return PaymentResult{}, fmt.Errorf("LND payment error: %s", update.Error.Message)
+		case update.Result.Status == "SUCCEEDED":
+			if isZeroPreimage(update.Result.PaymentPreimage) {
+				return PaymentResult{}, fmt.Errorf("LND: %w", ErrNoPreimage)
+			}
+			return PaymentResult{
+				Preimage: update.Result.PaymentPreimage,
+				FeeSat:   feeSatFromMsat(update.Result.FeeMsat),
+			}, nil
+		case update.Result.Status == "FAILED":
+			reason := strings.TrimPrefix(update.Result.FailureReason, "FAILURE_REASON_")
+			if reason == "INSUFFICIENT_BALANCE" {
+				return PaymentResult{}, fmt.Errorf("LND payment failed: %w", ErrInsufficientBalance)
+			}
+			return PaymentResult{}, fmt.Errorf("LND payment failed: %s", strings.ReplaceAll(strings.ToLower(reason), "_", " "))
+		}
+	}
+}
+
+// feeLimitSat returns the routing fee cap for a payment: FeeLimitSat, or 5%
+// of the amount but at least 10 sats.
+func (w *LNDWallet) feeLimitSat(payload map[string]interface{}) int64 {
+	if w.FeeLimitSat > 0 {
+		return w.FeeLimitSat
+	}
+	var amountSat int64
+	if invoice, ok := payload["payment_request"].(string); ok {
+		if msat, err := invoiceAmountMsat(invoice); err == nil {
+			amountSat = msatToSat(msat)
+		}
+	} else if amt, ok := payload["amt"].(string); ok {
+		amountSat, _ = strconv.ParseInt(amt, 10, 64)
+	}
+	if limit := amountSat / 20; limit > 10 {
+		return limit
+	}
+	return 10
+}
+
+// sendPaymentV1 pays via the legacy, blocking /v1/channels/transactions.
+func (w *LNDWallet) sendPaymentV1(ctx context.Context, payload map[string]interface{}) (PaymentResult, error) {
 	jsonPayload, _ := json.Marshal(payload)
 
 	url := fmt.Sprintf("https://%s/v1/channels/transactions", w.Host)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonPayload))
 	if err != nil {
-		return "", err
+		return PaymentResult{}, err
 	}
 
 	// Decode macaroon from hex
 	macaroonBytes, err := hex.DecodeString(w.Macaroon)
 	if err != nil {
-		return "", fmt.Errorf("invalid macaroon hex: %w", err)
+		return PaymentResult{}, fmt.Errorf("invalid macaroon hex: %w", err)
 	}
 
 	req.Header.Set("Grpc-Metadata-macaroon", hex.EncodeToString(macaroonBytes))
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := w.client.Do(req)
+	client, err := w.httpClient()
+	if err != nil {
+		return PaymentResult{}, err
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("LND API error: %w", err)
+		return PaymentResult{}, payCallError(walletRequestError("LND", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("LND payment failed: %s", string(body))
+		return PaymentResult{}, walletStatusError("LND", resp)
 	}
 
 	var result struct {
 		PaymentPreimage string `json:"payment_preimage"`
 		PaymentError    string `json:"payment_error"`
+		PaymentRoute    struct {
+			TotalFeesMsat int64 `json:"total_fees_msat,string"`
+		} `json:"payment_route"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+		return PaymentResult{}, err
 	}
 
 	if result.PaymentError != "" {
-		return "", fmt.Errorf("LND payment error: %s", result.PaymentError)
+		return PaymentResult{}, fmt.Errorf("LND payment error: %s", result.PaymentError)
 	}
 
-	// LND returns base64, we need hex
-	preimageBytes, err := hex.DecodeString(result.PaymentPreimage)
-	if err != nil {
-		// It might already be hex
-		return result.PaymentPreimage, nil
+	if result.PaymentPreimage == "" {
+		return PaymentResult{}, fmt.Errorf("LND: %w", ErrNoPreimage)
+	}
+
+	paid := PaymentResult{
+		Preimage: result.PaymentPreimage,
+		FeeSat:   feeSatFromMsat(result.PaymentRoute.TotalFeesMsat),
 	}
 
-	return hex.EncodeToString(preimageBytes), nil
+	// The v1 REST API returns the preimage base64-encoded; we need hex.
+	if preimageBytes, err := hex.DecodeString(paid.Preimage); err == nil && len(preimageBytes) == 32 {
+		return paid, nil
+	}
+	preimageBytes, err := base64.StdEncoding.DecodeString(paid.Preimage)
+	if err != nil {
+		return PaymentResult{}, fmt.Errorf("LND returned a malformed preimage: %w", err)
+	}
+	paid.Preimage = hex.EncodeToString(preimageBytes)
+	return paid, nil
 }
 
+// EstimateFee estimates the routing fee, in satoshis, for paying invoice
+// from this node, using LND's queryroutes. It fails for zero-amount invoices
+// and when no route is found (e.g. the payee is only reachable via private
+// channels).
+func (w *LNDWallet) EstimateFee(invoice string) (int64, error) {
+	inv, err := DecodeInvoice(invoice)
+	if err != nil {
+		return 0, err
+	}
+	if inv.AmountSat == 0 {
+		return 0, errors.New("cannot estimate fees for a zero-amount invoice")
+	}
+
+	url := fmt.Sprintf("https://%s/v1/graph/routes/%s/%d", w.Host, inv.Payee, inv.AmountSat)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Grpc-Metadata-macaroon", w.Macaroon)
+
+	client, err := w.httpClient()
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("LND API error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, newWalletError("LND", resp)
+	}
+
+	var result struct {
+		Routes []struct {
+			TotalFeesMsat int64 `json:"total_fees_msat,string"`
+		} `json:"routes"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+
+	if len(result.Routes) == 0 {
+		return 0, errors.New("LND found no route")
+	}
 
+	return msatToSat(result.Routes[0].TotalFeesMsat), nil
+}
@@ -0,0 +1,784 @@
+package satgate_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	satgate "github.com/SatGate-io/satgate/sdk/go"
+	"github.com/SatGate-io/satgate/sdk/go/satgatetest"
+)
+
+// BenchmarkGetReusesConnection pays once, then repeats Get with the cached
+// token against the same host, reporting how many connections the server
+// saw. With keep-alives working that stays at one.
+func BenchmarkGetReusesConnection(b *testing.B) {
+	var conns atomic.Int64
+	srv := httptest.NewUnstartedServer(satgatetest.L402Handler(10, okHandler))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	client := satgate.NewClient(satgatetest.NewMockWallet(), satgate.WithVerbose(false))
+	get(b, client, srv.URL+"/premium")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		get(b, client, srv.URL+"/premium")
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(conns.Load()), "conns")
+	if n := conns.Load(); n != 1 {
+		b.Errorf("server saw %d connections, want 1", n)
+	}
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "OK\n")
+})
+
+// get fetches url with client, failing unless it answers 200, and reads the
+// body to the end so the connection can be reused.
+func get(tb testing.TB, client *satgate.Client, url string) string {
+	tb.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		tb.Fatalf("Get(%s): %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tb.Fatalf("reading %s: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		tb.Fatalf("Get(%s): HTTP %d: %s", url, resp.StatusCode, body)
+	}
+	return string(body)
+}
+
+// TestPaidResponseIsStreamed checks that the body of the paid retry reaches
+// the caller unread: the first chunk arrives while the server is still
+// holding back the rest, and a multi-megabyte body is read without
+// allocating anything like its size.
+func TestPaidResponseIsStreamed(t *testing.T) {
+	const chunkSize, chunks = 64 << 10, 256 // 16 MiB
+	firstRead := make(chan struct{})
+	srv := httptest.NewServer(satgatetest.L402Handler(10, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := bytes.Repeat([]byte("x"), chunkSize)
+		w.Write(chunk)
+		w.(http.Flusher).Flush()
+		select {
+		case <-firstRead:
+		case <-time.After(5 * time.Second):
+			return // the client is waiting for the whole body
+		}
+		for i := 1; i < chunks; i++ {
+			w.Write(chunk)
+		}
+	})))
+	defer srv.Close()
+
+	client := satgate.NewClient(satgatetest.NewMockWallet(), satgate.WithVerbose(false))
+	resp, err := client.Get(srv.URL + "/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.ReadFull(resp.Body, make([]byte, chunkSize)); err != nil {
+		t.Fatalf("reading the first chunk: %v", err)
+	}
+	close(firstRead)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	n, err := io.Copy(io.Discard, resp.Body)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != (chunks-1)*chunkSize {
+		t.Fatalf("read %d bytes after the first chunk, want %d", n, (chunks-1)*chunkSize)
+	}
+	// The server runs in this process too, so allow for its allocations.
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > chunks*chunkSize/4 {
+		t.Errorf("reading the body allocated %d bytes; it should be streamed", allocated)
+	}
+}
+
+// TestMaxCacheEntriesEvictsLeastRecentlyUsed caches n+1 tokens in a cache
+// bounded to n and checks that only the oldest has to be paid for again.
+func TestMaxCacheEntriesEvictsLeastRecentlyUsed(t *testing.T) {
+	const n = 3
+	srv := satgatetest.NewL402Server(10)
+	defer srv.Close()
+	wallet := satgatetest.NewMockWallet()
+	client := satgate.NewClient(wallet, satgate.WithMaxCacheEntries(n), satgate.WithVerbose(false))
+
+	for i := 0; i <= n; i++ {
+		get(t, client, fmt.Sprintf("%s/item/%d", srv.URL, i))
+	}
+	if paid := len(wallet.Paid()); paid != n+1 {
+		t.Fatalf("paid %d invoices for %d URLs", paid, n+1)
+	}
+
+	// The newest n are still cached...
+	for i := 1; i <= n; i++ {
+		get(t, client, fmt.Sprintf("%s/item/%d", srv.URL, i))
+	}
+	if paid := len(wallet.Paid()); paid != n+1 {
+		t.Errorf("paid again for a cached token: %d payments", paid)
+	}
+	// ...but the oldest was evicted.
+	get(t, client, srv.URL+"/item/0")
+	if paid := len(wallet.Paid()); paid != n+2 {
+		t.Errorf("the oldest token was still cached: %d payments", paid)
+	}
+}
+
+// TestRedirectToChallenge follows a redirect that lands on a 402, pays at the
+// final URL and reuses that token when the redirect is followed again.
+func TestRedirectToChallenge(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/premium", http.StatusFound))
+	mux.Handle("/premium", satgatetest.L402Handler(10, okHandler))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	wallet := satgatetest.NewMockWallet()
+	client := satgate.NewClient(wallet, satgate.WithVerbose(false))
+	var endpoint string
+	client.OnPayment = func(info satgate.PaymentInfo) { endpoint = info.Endpoint }
+
+	if body := get(t, client, srv.URL+"/old"); body != "OK\n" {
+		t.Errorf("body = %q", body)
+	}
+	if endpoint != srv.URL+"/premium" {
+		t.Errorf("paid for %q, want the redirect target", endpoint)
+	}
+
+	get(t, client, srv.URL+"/old")
+	if paid := len(wallet.Paid()); paid != 1 {
+		t.Errorf("paid %d invoices, want 1", paid)
+	}
+}
+
+// TestPaidButRetryFailed drops the connection on the authenticated retry and
+// checks that the payment is still reported, counted and its token kept.
+func TestPaidButRetryFailed(t *testing.T) {
+	var drop atomic.Bool
+	drop.Store(true)
+	srv := httptest.NewServer(satgatetest.L402Handler(10, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if drop.Load() {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		okHandler(w, r)
+	})))
+	defer srv.Close()
+
+	wallet := satgatetest.NewMockWallet()
+	client := satgate.NewClient(wallet, satgate.WithVerbose(false))
+	result, err := client.DoResult("GET", srv.URL+"/premium", nil)
+	if err == nil {
+		result.Body.Close()
+		t.Fatal("retry succeeded on a dropped connection")
+	}
+	if result == nil || !result.Paid || result.AmountSat != 10 {
+		t.Errorf("result = %+v, want the 10 sat payment reported", result)
+	}
+	if stats := client.Stats(); stats.PaidSat != 10 || stats.PaymentCount != 1 || stats.FailedPaymentCount != 0 {
+		t.Errorf("stats = %+v, want one 10 sat payment", stats)
+	}
+
+	// The token was cached, so trying again doesn't pay twice.
+	drop.Store(false)
+	get(t, client, srv.URL+"/premium")
+	if paid := len(wallet.Paid()); paid != 1 {
+		t.Errorf("paid %d invoices, want 1", paid)
+	}
+}
+
+// TestChallengeOn401 pays an L402 challenge sent with 401 Unauthorized, but
+// only with WithChallengeOn401.
+func TestChallengeOn401(t *testing.T) {
+	l402 := satgatetest.L402Handler(10, okHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l402.ServeHTTP(unauthorizedWriter{w}, r)
+	}))
+	defer srv.Close()
+
+	wallet := satgatetest.NewMockWallet()
+	client := satgate.NewClient(wallet, satgate.WithVerbose(false))
+	resp, err := client.Get(srv.URL + "/premium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || len(wallet.Attempts()) != 0 {
+		t.Fatalf("without WithChallengeOn401: HTTP %d after %d payments, want 401 unpaid",
+			resp.StatusCode, len(wallet.Attempts()))
+	}
+
+	client = satgate.NewClient(wallet, satgate.WithChallengeOn401(true), satgate.WithVerbose(false))
+	if body := get(t, client, srv.URL+"/premium"); body != "OK\n" {
+		t.Errorf("body = %q", body)
+	}
+	if paid := len(wallet.Paid()); paid != 1 {
+		t.Errorf("paid %d invoices, want 1", paid)
+	}
+}
+
+// unauthorizedWriter turns a 402 into a 401, as some gateways send it.
+type unauthorizedWriter struct {
+	http.ResponseWriter
+}
+
+func (w unauthorizedWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusPaymentRequired {
+		statusCode = http.StatusUnauthorized
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// TestGzipPaidResponse checks that a gzip-encoded response to the paid retry
+// reaches the caller decompressed: the client mustn't turn off the
+// transport's transparent decompression.
+func TestGzipPaidResponse(t *testing.T) {
+	const payload = `{"data": "premium"}`
+	srv := httptest.NewServer(satgatetest.L402Handler(10, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			http.Error(w, "gzip required", http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, payload)
+		zw.Close()
+	})))
+	defer srv.Close()
+
+	client := satgate.NewClient(satgatetest.NewMockWallet(), satgate.WithVerbose(false))
+	resp, err := client.Get(srv.URL + "/premium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != payload {
+		t.Errorf("HTTP %d: %q, want %q", resp.StatusCode, body, payload)
+	}
+	if !resp.Uncompressed {
+		t.Error("response was not decompressed by the transport")
+	}
+}
+
+// TestMockWalletScripting runs the client against scripted MockWallet
+// responses: a failure, a wrong preimage, then the default success.
+func TestMockWalletScripting(t *testing.T) {
+	srv := satgatetest.NewL402Server(10)
+	defer srv.Close()
+	wallet := satgatetest.NewMockWallet()
+	client := satgate.NewClient(wallet, satgate.WithVerbose(false))
+
+	noRoute := errors.New("no route")
+	wallet.FailNext(noRoute)
+	if _, err := client.Get(srv.URL + "/premium"); !errors.Is(err, satgate.ErrPaymentFailed) || !errors.Is(err, noRoute) {
+		t.Errorf("scripted failure: err = %v", err)
+	}
+
+	wallet.QueueResponse(strings.Repeat("ab", 32), nil)
+	if _, err := client.Get(srv.URL + "/premium"); !errors.Is(err, satgate.ErrPreimageMismatch) {
+		t.Errorf("scripted preimage: err = %v, want ErrPreimageMismatch", err)
+	}
+
+	get(t, client, srv.URL+"/premium")
+	if attempts, paid := len(wallet.Attempts()), len(wallet.Paid()); attempts != 3 || paid != 2 {
+		t.Errorf("%d attempts, %d paid; want 3 and 2", attempts, paid)
+	}
+}
+
+// TestL402ServerEndToEnd pays NewL402Server's challenge with a MockWallet and
+// checks the loop closes: the preimage is the invoice's, the server accepts
+// it, and the cached token is reused without paying again.
+func TestL402ServerEndToEnd(t *testing.T) {
+	srv := satgatetest.NewL402Server(25)
+	defer srv.Close()
+	wallet := satgatetest.NewMockWallet()
+	client := satgate.NewClient(wallet, satgate.WithVerbose(false))
+	var payments []satgate.PaymentInfo
+	client.OnPayment = func(info satgate.PaymentInfo) { payments = append(payments, info) }
+
+	if body := get(t, client, srv.URL+"/premium"); body != "OK\n" {
+		t.Errorf("body = %q", body)
+	}
+	if len(payments) != 1 {
+		t.Fatalf("%d payments, want 1", len(payments))
+	}
+	info := payments[0]
+	if info.AmountSat != 25 {
+		t.Errorf("paid %d sats, want 25", info.AmountSat)
+	}
+	want, err := satgatetest.PreimageFor(info.Invoice)
+	if err != nil || info.Preimage != want {
+		t.Errorf("preimage = %s, want %s (%v)", info.Preimage, want, err)
+	}
+	preimage, _ := hex.DecodeString(info.Preimage)
+	if hash := sha256.Sum256(preimage); hex.EncodeToString(hash[:]) != info.PaymentHash {
+		t.Errorf("sha256(preimage) = %x, want payment hash %s", hash, info.PaymentHash)
+	}
+
+	get(t, client, srv.URL+"/premium")
+	if stats := client.Stats(); stats.PaymentCount != 1 || stats.CacheHitCount != 1 {
+		t.Errorf("stats = %+v, want 1 payment and 1 cache hit", stats)
+	}
+}
+
+// TestTokenEncryptionKeyMismatch persists a token under one key and checks
+// that a client with another key, or none, refuses the store.
+func TestTokenEncryptionKeyMismatch(t *testing.T) {
+	srv := satgatetest.NewL402Server(10)
+	defer srv.Close()
+	store := &memoryStore{}
+	key := bytes.Repeat([]byte{1}, 32)
+
+	client := satgate.NewClient(satgatetest.NewMockWallet(), satgate.WithCacheStore(store),
+		satgate.WithTokenEncryptionKey(key), satgate.WithVerbose(false))
+	if err := client.CacheStoreErr(); err != nil {
+		t.Fatal(err)
+	}
+	get(t, client, srv.URL+"/premium")
+
+	client = satgate.NewClient(satgatetest.NewMockWallet(), satgate.WithCacheStore(store),
+		satgate.WithTokenEncryptionKey(key), satgate.WithVerbose(false))
+	if err := client.CacheStoreErr(); err != nil {
+		t.Fatalf("same key: %v", err)
+	}
+	if _, ok := client.CachedAuthorization(srv.URL + "/premium"); !ok {
+		t.Error("same key: token not loaded")
+	}
+
+	for name, opt := range map[string]satgate.ClientOption{
+		"wrong key":   satgate.WithTokenEncryptionKey(bytes.Repeat([]byte{2}, 32)),
+		"invalid key": satgate.WithTokenEncryptionKey([]byte("short")),
+		"no key":      satgate.WithVerbose(false),
+	} {
+		var log bytes.Buffer
+		client := satgate.NewClient(satgatetest.NewMockWallet(), satgate.WithCacheStore(store), opt,
+			satgate.WithLogger(slog.New(slog.NewTextHandler(&log, nil))))
+		if err := client.CacheStoreErr(); !errors.Is(err, satgate.ErrTokenCacheKey) {
+			t.Errorf("%s: CacheStoreErr() = %v, want ErrTokenCacheKey", name, err)
+		}
+		if !strings.Contains(log.String(), "level=ERROR") {
+			t.Errorf("%s: nothing logged", name)
+		}
+	}
+}
+
+// TestCustomAmountDecoder pays an invoice the client can't decode itself,
+// with the amount read by the AmountDecoder.
+func TestCustomAmountDecoder(t *testing.T) {
+	const invoice = "lnbcrt1custom"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", `L402 macaroon="AgEEbHNhdA", invoice="`+invoice+`"`)
+			w.WriteHeader(http.StatusPaymentRequired)
+			return
+		}
+		okHandler(w, r)
+	}))
+	defer srv.Close()
+
+	wallet := satgatetest.NewMockWallet()
+	client := satgate.NewClient(wallet, satgate.WithVerbose(false))
+	if _, err := client.Get(srv.URL); err == nil || len(wallet.Attempts()) != 0 {
+		t.Fatalf("default decoder: err = %v after %d payments, want an invalid invoice unpaid", err, len(wallet.Attempts()))
+	}
+
+	client = satgate.NewClient(wallet, satgate.WithVerbose(false),
+		satgate.WithAmountDecoder(satgate.AmountDecoderFunc(func(invoice string) (int64, error) {
+			return 21000, nil
+		})))
+	if body := get(t, client, srv.URL); body != "OK\n" {
+		t.Errorf("body = %q", body)
+	}
+	if paid := client.Stats().PaidSat; paid != 21 {
+		t.Errorf("PaidSat = %d, want 21", paid)
+	}
+}
+
+// TestRetryBackoffCancelled cancels a request while the client waits to
+// retry a transient wallet failure, and checks that the error reports both.
+func TestRetryBackoffCancelled(t *testing.T) {
+	srv := httptest.NewServer(satgatetest.L402Handler(10, okHandler))
+	defer srv.Close()
+
+	wallet := satgatetest.NewMockWallet()
+	wallet.FailNext(&satgate.TransientError{Err: errors.New("wallet unreachable")})
+	client := satgate.NewClient(wallet, satgate.WithVerbose(false), satgate.WithPaymentRetry(3, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := client.GetCtx(ctx, srv.URL+"/premium")
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "wallet unreachable") {
+		t.Errorf("err = %v, want the deadline and the wallet error", err)
+	}
+	if stats := client.Stats(); stats.PaidSat != 0 || len(wallet.Attempts()) != 1 {
+		t.Errorf("stats = %+v after %d attempts, want one unpaid attempt", stats, len(wallet.Attempts()))
+	}
+}
+
+// TestProactiveRefreshOnlyForGet uses GET and POST tokens close to expiry
+// and checks that only the GET token is refreshed, so a POST is never
+// replayed in the background.
+func TestProactiveRefreshOnlyForGet(t *testing.T) {
+	var unpaidPosts, unpaidGets atomic.Int64
+	l402 := satgatetest.L402Handler(10, okHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			if r.Method == http.MethodPost {
+				unpaidPosts.Add(1)
+			} else {
+				unpaidGets.Add(1)
+			}
+		}
+		l402.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	now := time.Now()
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	client := satgate.NewClient(satgatetest.NewMockWallet(), satgate.WithVerbose(false),
+		satgate.WithClock(clock), satgate.WithCacheTTL(time.Minute), satgate.WithCacheTTLJitter(0),
+		satgate.WithProactiveRefresh(true))
+	defer client.Close()
+
+	post := func() {
+		resp, err := client.Post(srv.URL+"/submit", map[string]string{"a": "b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	post()
+	get(t, client, srv.URL+"/premium")
+
+	mu.Lock()
+	now = now.Add(55 * time.Second)
+	mu.Unlock()
+	post()
+	get(t, client, srv.URL+"/premium")
+
+	for deadline := time.Now().Add(5 * time.Second); unpaidGets.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if gets, posts := unpaidGets.Load(), unpaidPosts.Load(); gets != 2 || posts != 1 {
+		t.Errorf("sent %d GETs and %d POSTs without a token, want 2 and 1", gets, posts)
+	}
+}
+
+// TestInsecureTLSWarning checks that WithInsecureTLS is always warned
+// about: on stderr with verbose output off, or through the logger.
+func TestInsecureTLSWarning(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	satgate.NewClient(satgatetest.NewMockWallet(), satgate.WithInsecureTLS(true), satgate.WithVerbose(false))
+	os.Stderr = stderr
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if !strings.Contains(string(out), "TLS certificate verification is DISABLED") {
+		t.Errorf("stderr = %q, want the warning", out)
+	}
+
+	var log bytes.Buffer
+	satgate.NewClient(satgate.NewLNDWalletInsecure("localhost:8080", "abcd"),
+		satgate.WithLogger(slog.New(slog.NewTextHandler(&log, nil))))
+	if !strings.Contains(log.String(), "level=WARN") {
+		t.Errorf("log = %q, want a warning", log.String())
+	}
+}
+
+// TestCancelDuringPayment cancels requests while the wallet is paying: a
+// ContextWallet sees the cancellation, a plain wallet is not waited for,
+// and either way the amount stays reserved because it may have been paid.
+func TestCancelDuringPayment(t *testing.T) {
+	srv := satgatetest.NewL402Server(10)
+	defer srv.Close()
+
+	cancellable := &blockingWallet{MockWallet: satgatetest.NewMockWallet(), release: make(chan struct{})}
+	client := satgate.NewClient(ctxWallet{cancellable}, satgate.WithVerbose(false))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.GetCtx(ctx, srv.URL+"/premium")
+	if !errors.Is(err, satgate.ErrPaymentInterrupted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ContextWallet: err = %v, want ErrPaymentInterrupted", err)
+	}
+	waitFor(func() bool { return client.Stats().PendingPaymentCount > 0 })
+	if stats := client.Stats(); stats.PaidSat != 10 || stats.PendingPaymentCount != 1 || stats.FailedPaymentCount != 0 {
+		t.Errorf("ContextWallet: stats = %+v, want 10 sats pending", stats)
+	}
+
+	plain := &blockingWallet{MockWallet: satgatetest.NewMockWallet(), release: make(chan struct{})}
+	client = satgate.NewClient(plain, satgate.WithVerbose(false))
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := client.GetCtx(ctx, srv.URL+"/premium"); !errors.Is(err, satgate.ErrPaymentInterrupted) || !errors.Is(err, context.Canceled) {
+		t.Errorf("plain wallet: err = %v, want ErrPaymentInterrupted", err)
+	}
+	// The wallet pays after all: the payment is counted and its token kept.
+	close(plain.release)
+	waitFor(func() bool { return client.Stats().PaymentCount > 0 })
+	get(t, client, srv.URL+"/premium")
+	if paid := len(plain.Paid()); paid != 1 {
+		t.Errorf("plain wallet: paid %d invoices, want 1", paid)
+	}
+}
+
+// waitFor polls cond for up to five seconds, for work the client finishes
+// in the background.
+func waitFor(cond func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); !cond() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// blockingWallet is a MockWallet that doesn't pay until release is closed.
+type blockingWallet struct {
+	*satgatetest.MockWallet
+	release chan struct{}
+}
+
+func (w *blockingWallet) PayInvoice(invoice string) (string, error) {
+	<-w.release
+	return w.MockWallet.PayInvoice(invoice)
+}
+
+// ctxWallet makes a blockingWallet cancellable.
+type ctxWallet struct {
+	*blockingWallet
+}
+
+func (w ctxWallet) PayInvoiceCtx(ctx context.Context, invoice string) (string, error) {
+	select {
+	case <-w.release:
+		return w.MockWallet.PayInvoice(invoice)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// memoryStore is a CacheStore kept in memory.
+type memoryStore struct {
+	mu     sync.Mutex
+	tokens []satgate.StoredToken
+}
+
+func (s *memoryStore) Load() ([]satgate.StoredToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]satgate.StoredToken(nil), s.tokens...), nil
+}
+
+func (s *memoryStore) Save(tokens []satgate.StoredToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = append([]satgate.StoredToken(nil), tokens...)
+	return nil
+}
+
+// TestSharedWalletReconfigured creates clients with WithProxy and
+// WithPaymentTimeout for a wallet that is paying invoices at the same time. Calls made afterwards go through
+// the proxy; run with -race to check the wallet is reconfigured safely.
+func TestSharedWalletReconfigured(t *testing.T) {
+	var direct, proxied atomic.Int64
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		direct.Add(1)
+		http.Error(w, "no route", http.StatusInternalServerError)
+	}))
+	defer node.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		http.Error(w, "no route", http.StatusInternalServerError)
+	}))
+	defer proxy.Close()
+
+	wallet := satgate.NewLNBitsWallet(node.URL, "admin-key")
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_, _ = wallet.PayInvoice("lnbc1")
+				}
+			}
+		}()
+	}
+	for direct.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 20; i++ {
+		satgate.NewClient(wallet, satgate.WithProxy(proxy.URL), satgate.WithPaymentTimeout(time.Minute))
+	}
+	close(stop)
+	wg.Wait()
+
+	before := direct.Load()
+	if _, err := wallet.PayInvoice("lnbc1"); err == nil {
+		t.Fatal("PayInvoice succeeded")
+	}
+	if direct.Load() != before || proxied.Load() == 0 {
+		t.Errorf("payment did not go through the proxy (direct %d→%d, proxied %d)", before, direct.Load(), proxied.Load())
+	}
+}
+
+// TestLNDPaymentTimeoutAfterFirstUse sets WithPaymentTimeout on an LND
+// wallet that has already made a call, and checks that the wallet's API
+// calls then time out accordingly.
+func TestLNDPaymentTimeoutAfterFirstUse(t *testing.T) {
+	var calls atomic.Int64
+	node := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if calls.Add(1) > 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(3 * time.Second):
+			}
+		}
+		http.Error(w, "no route", http.StatusInternalServerError)
+	}))
+	defer node.Close()
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: node.Certificate().Raw})
+	wallet := satgate.NewLNDWalletWithCert(strings.TrimPrefix(node.URL, "https://"), "abcd", cert)
+	if _, err := wallet.PayInvoice("lnbc1"); err == nil {
+		t.Fatal("PayInvoice succeeded")
+	}
+	satgate.NewClient(wallet, satgate.WithPaymentTimeout(500*time.Millisecond))
+
+	start := time.Now()
+	if _, err := wallet.PayInvoice("lnbc1"); err == nil {
+		t.Fatal("PayInvoice succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("PayInvoice took %s with a 500ms payment timeout", elapsed)
+	}
+}
+
+// TestKeysendThroughFailover pays a keysend challenge with a FailoverWallet
+// whose second wallet is the only one that supports keysend.
+func TestKeysendThroughFailover(t *testing.T) {
+	dest := "02" + strings.Repeat("ab", 32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", `L402 macaroon="AgEEbHNhdA", keysend="`+dest+`", amount="21"`)
+			w.WriteHeader(http.StatusPaymentRequired)
+			return
+		}
+		okHandler(w, r)
+	}))
+	defer srv.Close()
+
+	keysender := &keysendWallet{}
+	client := satgate.NewClient(satgate.NewFailoverWallet(satgatetest.NewMockWallet(), keysender), satgate.WithVerbose(false))
+	if body := get(t, client, srv.URL); body != "OK\n" {
+		t.Errorf("body = %q", body)
+	}
+	if keysender.paid.Load() != 21 {
+		t.Errorf("keysend paid %d sats, want 21", keysender.paid.Load())
+	}
+
+	client = satgate.NewClient(satgatetest.NewMockWallet(), satgate.WithVerbose(false))
+	if _, err := client.Get(srv.URL); !errors.Is(err, satgate.ErrKeysendUnsupported) {
+		t.Errorf("err = %v, want ErrKeysendUnsupported", err)
+	}
+}
+
+// keysendWallet pays only via keysend.
+type keysendWallet struct {
+	paid atomic.Int64
+}
+
+func (w *keysendWallet) PayInvoice(invoice string) (string, error) {
+	return "", errors.New("unexpected invoice payment")
+}
+
+func (w *keysendWallet) PayKeysend(dest string, amountSat int64) (string, error) {
+	w.paid.Add(amountSat)
+	return strings.Repeat("11", 32), nil
+}
+
+// TestResolverInsideFailover pays a challenge whose invoice is a payment
+// hint, resolved by a wallet inside a FailoverWallet.
+func TestResolverInsideFailover(t *testing.T) {
+	invoice, _ := satgatetest.NewInvoice(21, "premium")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", `L402 macaroon="AgEEbHNhdA", invoice="user@example.com"`)
+			w.WriteHeader(http.StatusPaymentRequired)
+			return
+		}
+		okHandler(w, r)
+	}))
+	defer srv.Close()
+
+	wallet := resolvingWallet{satgatetest.NewMockWallet(), invoice}
+	client := satgate.NewClient(satgate.NewFailoverWallet(wallet), satgate.WithVerbose(false))
+	if body := get(t, client, srv.URL); body != "OK\n" {
+		t.Errorf("body = %q", body)
+	}
+	if paid := wallet.Paid(); len(paid) != 1 || paid[0] != invoice {
+		t.Errorf("paid %q, want the resolved invoice", paid)
+	}
+}
+
+// resolvingWallet resolves every payment hint to the same invoice.
+type resolvingWallet struct {
+	*satgatetest.MockWallet
+	invoice string
+}
+
+func (w resolvingWallet) ResolveInvoice(input string) (string, error) {
+	return w.invoice, nil
+}
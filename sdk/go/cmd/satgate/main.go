@@ -0,0 +1,198 @@
+// Command satgate fetches a URL like curl, paying any L402 challenge on the
+// way. It is meant for poking at L402 services without writing Go.
+//
+//	satgate --lnbits-url https://legend.lnbits.com --lnbits-key KEY https://api.example.com/premium
+//	satgate -X POST -d '{"q":"hi"}' -H 'Content-Type: application/json' https://api.example.com/query
+//
+// Without wallet flags, the wallet is read from the environment (see
+// satgate.NewWalletFromEnv), e.g. SATGATE_LNBITS_URL and SATGATE_LNBITS_KEY,
+// or SATGATE_NWC_URI. The response body is written to
+// stdout; the status and sats spent are reported on stderr.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	satgate "github.com/SatGate-io/satgate/sdk/go"
+)
+
+// headerFlags collects repeated -H flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string { return strings.Join(*h, ", ") }
+
+func (h *headerFlags) Set(v string) error {
+	if _, _, ok := strings.Cut(v, ":"); !ok {
+		return fmt.Errorf("header %q is not in \"Name: value\" form", v)
+	}
+	*h = append(*h, v)
+	return nil
+}
+
+type options struct {
+	method    string
+	data      string
+	headers   headerFlags
+	lnbitsURL string
+	lnbitsKey string
+	nwcURI    string
+	verbose   bool
+	url       string
+}
+
+func main() {
+	opts, err := parseArgs(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "satgate:", err)
+		os.Exit(2)
+	}
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "satgate:", err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs parses the command line. Flags may come before or after the
+// URL, as with curl.
+func parseArgs(args []string) (*options, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("satgate", flag.ContinueOnError)
+	fs.StringVar(&opts.method, "X", "", "HTTP method (default GET, or POST with -d)")
+	fs.StringVar(&opts.data, "d", "", "request body; @file reads it from a file, @- from stdin")
+	fs.Var(&opts.headers, "H", "request header \"Name: value\" (repeatable)")
+	fs.StringVar(&opts.lnbitsURL, "lnbits-url", "", "LNBits instance URL")
+	fs.StringVar(&opts.lnbitsKey, "lnbits-key", "", "LNBits admin key")
+	fs.StringVar(&opts.nwcURI, "nwc", "", "Nostr Wallet Connect URI")
+	fs.BoolVar(&opts.verbose, "v", false, "log the L402 flow to stderr")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: satgate [flags] URL")
+		fs.PrintDefaults()
+	}
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		if opts.url != "" {
+			return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+		}
+		opts.url, args = fs.Arg(0), fs.Args()[1:]
+	}
+	if opts.url == "" {
+		fs.Usage()
+		return nil, errors.New("no URL given")
+	}
+	return opts, nil
+}
+
+func run(opts *options) error {
+	wallet, err := newWallet(opts)
+	if err != nil {
+		return err
+	}
+
+	client := satgate.NewClient(wallet,
+		satgate.WithVerbose(opts.verbose),
+		satgate.WithVerboseWriter(os.Stderr),
+	)
+	defer client.Close()
+
+	method, body, contentType, err := requestBody(opts)
+	if err != nil {
+		return err
+	}
+	var callOpts []satgate.CallOption
+	for _, h := range opts.headers {
+		name, value, _ := strings.Cut(h, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if strings.EqualFold(name, "Content-Type") {
+			contentType = value
+			continue
+		}
+		callOpts = append(callOpts, satgate.WithHeader(name, value))
+	}
+
+	resp, err := client.DoRawCtx(context.Background(), method, opts.url, body, contentType, callOpts...)
+	defer reportSpend(client)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	fmt.Fprintln(os.Stderr, resp.Proto, resp.Status)
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
+
+// newWallet builds the wallet selected by the flags, falling back to the
+// environment.
+func newWallet(opts *options) (satgate.LightningWallet, error) {
+	switch {
+	case opts.nwcURI != "" && opts.lnbitsKey != "":
+		return nil, errors.New("both an LNBits and an NWC wallet are configured; pick one")
+	case opts.nwcURI != "":
+		return satgate.NewNWCWallet(opts.nwcURI)
+	case opts.lnbitsKey != "":
+		if opts.lnbitsURL == "" {
+			return nil, errors.New("--lnbits-key needs --lnbits-url")
+		}
+		return satgate.NewLNBitsWallet(opts.lnbitsURL, opts.lnbitsKey), nil
+	case opts.lnbitsURL != "":
+		return nil, errors.New("--lnbits-url needs --lnbits-key")
+	default:
+		return satgate.NewWalletFromEnv()
+	}
+}
+
+// requestBody returns the method and body for -X and -d. Like curl, -d
+// implies POST and a form content type unless told otherwise.
+func requestBody(opts *options) (method string, body io.Reader, contentType string, err error) {
+	method = opts.method
+	if opts.data == "" {
+		if method == "" {
+			method = http.MethodGet
+		}
+		return method, nil, "", nil
+	}
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	data := []byte(opts.data)
+	switch {
+	case opts.data == "@-":
+		data, err = io.ReadAll(os.Stdin)
+	case strings.HasPrefix(opts.data, "@"):
+		data, err = os.ReadFile(opts.data[1:])
+	}
+	if err != nil {
+		return "", nil, "", fmt.Errorf("reading request body: %w", err)
+	}
+	return method, strings.NewReader(string(data)), "application/x-www-form-urlencoded", nil
+}
+
+// reportSpend prints what the request cost on stderr.
+func reportSpend(client *satgate.Client) {
+	stats := client.Stats()
+	switch {
+	case stats.FeeSat > 0:
+		fmt.Fprintf(os.Stderr, "⚡ Paid %d sats (+%d sats in fees)\n", stats.PaidSat, stats.FeeSat)
+	case stats.PaymentCount > 0 || stats.PaidSat > 0:
+		fmt.Fprintf(os.Stderr, "⚡ Paid %d sats\n", stats.PaidSat)
+	default:
+		fmt.Fprintln(os.Stderr, "⚡ No payment needed")
+	}
+}
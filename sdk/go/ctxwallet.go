@@ -0,0 +1,30 @@
+package satgate
+
+import "context"
+
+// ============================================================================
+// Cancellable Wallets
+// ============================================================================
+
+// ContextWallet is implemented by wallets whose payments can be cancelled.
+// The client pays through PayInvoiceCtx when a wallet has it, passing the
+// request's context, ending at the payment timeout if one is set (see
+// WithPaymentTimeout), so the wallet call stops when the request is
+// cancelled. Wallets without it are paid with PayInvoice. The built-in
+// LNBits, Alby and LND wallets implement it, and FailoverWallet,
+// RoutingWallet and LNURLWallet pass it through.
+//
+// A cancelled call may still leave a payment in flight that completes later:
+// its error doesn't show that nothing was paid. The client therefore fails
+// the request with ErrPaymentInterrupted and keeps the amount reserved
+// against the budget; if the wallet does return a preimage afterwards, the
+// payment is counted and its token cached.
+type ContextWallet interface {
+	PayInvoiceCtx(ctx context.Context, invoice string) (preimage string, err error)
+}
+
+// detailedContextWallet is implemented by the built-in wallets that can be
+// cancelled and report fees at once.
+type detailedContextWallet interface {
+	payInvoiceDetailed(ctx context.Context, invoice string) (PaymentResult, error)
+}
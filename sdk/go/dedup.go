@@ -0,0 +1,67 @@
+package satgate
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+// ============================================================================
+// Duplicate Invoice Protection
+// ============================================================================
+
+// defaultDedupWindow is how long a paid invoice's preimage is remembered by
+// default.
+const defaultDedupWindow = 5 * time.Minute
+
+// WithDedupWindow sets how long the client remembers the preimages of
+// invoices it has paid (default 5 minutes). If a server hands out an invoice
+// again within that window, e.g. after a retry on its side, the stored
+// preimage is reused instead of paying twice. Zero turns this off.
+func WithDedupWindow(d time.Duration) ClientOption {
+	return func(client *Client) {
+		client.dedupWindow = d
+	}
+}
+
+// recentPayment is the preimage of an invoice paid at paidAt.
+type recentPayment struct {
+	preimage string
+	paidAt   time.Time
+}
+
+// recentPreimage returns the preimage for paymentHash if that invoice was
+// paid within the dedup window.
+func (c *Client) recentPreimage(paymentHash []byte) (string, bool) {
+	if c.dedupWindow <= 0 || paymentHash == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	paid, ok := c.recentPayments[hex.EncodeToString(paymentHash)]
+	if !ok || c.now().Sub(paid.paidAt) > c.dedupWindow {
+		return "", false
+	}
+	return paid.preimage, true
+}
+
+// rememberPayment records that paymentHash was paid with preimage, dropping
+// entries that have aged out of the dedup window.
+func (c *Client) rememberPayment(paymentHash []byte, preimage string) {
+	if c.dedupWindow <= 0 || paymentHash == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for hash, paid := range c.recentPayments {
+		if now.Sub(paid.paidAt) > c.dedupWindow {
+			delete(c.recentPayments, hash)
+		}
+	}
+	if c.recentPayments == nil {
+		c.recentPayments = make(map[string]recentPayment)
+	}
+	c.recentPayments[hex.EncodeToString(paymentHash)] = recentPayment{preimage: preimage, paidAt: now}
+}
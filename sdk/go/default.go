@@ -0,0 +1,71 @@
+package satgate
+
+import (
+	"net/http"
+	"sync"
+)
+
+// ============================================================================
+// Default Client
+// ============================================================================
+
+var (
+	defaultMu     sync.Mutex
+	defaultClient *Client
+)
+
+// SetDefaultWallet makes the package-level Get, Post and Do pay with wallet,
+// through a new client with default options. A client created earlier for
+// them is dropped but not closed, so requests it is still serving complete.
+func SetDefaultWallet(wallet LightningWallet) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultClient = NewClient(wallet)
+}
+
+// DefaultClient returns the client behind the package-level Get, Post and
+// Do, e.g. to read its Stats. Unless SetDefaultWallet was called, it is
+// created on first use with the wallet configured by the environment (see
+// NewWalletFromEnv).
+func DefaultClient() (*Client, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultClient == nil {
+		wallet, err := NewWalletFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		defaultClient = NewClient(wallet)
+	}
+	return defaultClient, nil
+}
+
+// Get performs a GET request with the default client, paying any L402
+// challenge, like http.Get. It suits one-off scripts; programs that need
+// limits or other options should create their own Client.
+func Get(url string, opts ...CallOption) (*http.Response, error) {
+	client, err := DefaultClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Get(url, opts...)
+}
+
+// Post performs a POST request with body encoded as JSON, using the default
+// client (see Get).
+func Post(url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	client, err := DefaultClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Post(url, body, opts...)
+}
+
+// Do performs a request with any method using the default client (see Get).
+func Do(method, url string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	client, err := DefaultClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(method, url, body, opts...)
+}
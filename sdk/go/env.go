@@ -0,0 +1,86 @@
+package satgate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ============================================================================
+// Wallet From Environment
+// ============================================================================
+
+// envWallet describes the environment variables that configure one wallet.
+type envWallet struct {
+	name string
+	vars []string
+	new  func(values []string) (LightningWallet, error)
+}
+
+var envWallets = []envWallet{
+	{"LNBits", []string{"SATGATE_LNBITS_URL", "SATGATE_LNBITS_KEY"}, func(v []string) (LightningWallet, error) {
+		return NewLNBitsWallet(v[0], v[1]), nil
+	}},
+	{"Alby", []string{"SATGATE_ALBY_TOKEN"}, func(v []string) (LightningWallet, error) {
+		return NewAlbyWallet(v[0]), nil
+	}},
+	{"NWC", []string{"SATGATE_NWC_URI"}, func(v []string) (LightningWallet, error) {
+		return NewNWCWallet(v[0])
+	}},
+	{"LND", []string{"SATGATE_LND_HOST", "SATGATE_LND_MACAROON"}, func(v []string) (LightningWallet, error) {
+		return NewLNDWallet(v[0], v[1]), nil
+	}},
+}
+
+// NewWalletFromEnv returns the wallet configured by environment variables,
+// so credentials stay out of source:
+//
+//	SATGATE_LNBITS_URL + SATGATE_LNBITS_KEY   LNBits
+//	SATGATE_ALBY_TOKEN                        Alby
+//	SATGATE_NWC_URI                           Nostr Wallet Connect
+//	SATGATE_LND_HOST + SATGATE_LND_MACAROON   LND (REST, macaroon in hex)
+//
+// Exactly one wallet must be configured. It is an error if none is, if more
+// than one is, or if only some of a wallet's variables are set.
+func NewWalletFromEnv() (LightningWallet, error) {
+	var found []envWallet
+	var values [][]string
+	for _, w := range envWallets {
+		var set, missing []string
+		vals := make([]string, len(w.vars))
+		for i, name := range w.vars {
+			vals[i] = strings.TrimSpace(os.Getenv(name))
+			if vals[i] == "" {
+				missing = append(missing, name)
+			} else {
+				set = append(set, name)
+			}
+		}
+		if len(set) == 0 {
+			continue
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("satgate: %s wallet is partly configured: %s set but %s missing",
+				w.name, strings.Join(set, ", "), strings.Join(missing, ", "))
+		}
+		found = append(found, w)
+		values = append(values, vals)
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, errors.New("satgate: no wallet configured in the environment " +
+			"(set SATGATE_LNBITS_URL/SATGATE_LNBITS_KEY, SATGATE_ALBY_TOKEN, SATGATE_NWC_URI " +
+			"or SATGATE_LND_HOST/SATGATE_LND_MACAROON)")
+	case 1:
+		return found[0].new(values[0])
+	default:
+		names := make([]string, len(found))
+		for i, w := range found {
+			names[i] = w.name
+		}
+		return nil, fmt.Errorf("satgate: more than one wallet configured in the environment (%s); set only one",
+			strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,153 @@
+package satgate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrBudgetExceeded is returned when paying an invoice would push the
+// client's total spend past the limit set with WithMaxBudgetSat.
+var ErrBudgetExceeded = errors.New("satgate: budget exceeded")
+
+// ErrPaymentTooLarge is returned when a single invoice exceeds the
+// per-payment limit set with WithMaxPaymentSat.
+var ErrPaymentTooLarge = errors.New("satgate: payment too large")
+
+// ErrPreimageMismatch is returned when the preimage reported by the wallet
+// does not hash to the invoice's payment hash. The token is not cached.
+var ErrPreimageMismatch = errors.New("satgate: preimage does not match payment hash")
+
+// ErrPaymentNotAccepted is returned when the server still responds 402 to a
+// request retried with a freshly paid L402 token. The error message includes
+// the response body.
+var ErrPaymentNotAccepted = errors.New("satgate: payment not accepted")
+
+// ErrPreimageRejected is returned when the server answers a request retried
+// with a freshly paid L402 token with 401 Unauthorized, or with a 403
+// Forbidden about the token, rather than serving it: the proof of payment
+// was refused, which points at a mismatch between wallet and server rather
+// than an application error. The error message includes the server's
+// message, and the token is dropped from the cache.
+var ErrPreimageRejected = errors.New("satgate: preimage rejected")
+
+// ErrTokenCacheKey is reported by Client.CacheStoreErr, and logged, when
+// persisted tokens can't be decrypted with the key set by
+// WithTokenEncryptionKey, or the key itself is invalid.
+var ErrTokenCacheKey = errors.New("satgate: cannot decrypt token cache")
+
+// ErrRateLimited is returned when paying an invoice would exceed the spend
+// rate set with WithSpendRateLimit.
+var ErrRateLimited = errors.New("satgate: spend rate limit exceeded")
+
+// ErrInsufficientBalance is returned when a preflight balance check (see
+// WithPreflightBalanceCheck) shows the wallet can't cover the invoice.
+var ErrInsufficientBalance = errors.New("satgate: insufficient wallet balance")
+
+// ErrDryRun is returned in place of paying an invoice when the client was
+// created with WithDryRun(true). The error message includes the invoice and
+// its amount.
+var ErrDryRun = errors.New("satgate: dry run, invoice not paid")
+
+// ErrPaymentRejected is returned when the callback set with
+// WithPaymentApproval declines to pay an invoice, or the one set with
+// WithInvoiceSelector chooses none.
+var ErrPaymentRejected = errors.New("satgate: payment rejected")
+
+// ErrInvoiceExpired is returned when the invoice in an L402 challenge has
+// already expired. It is not paid.
+var ErrInvoiceExpired = errors.New("satgate: invoice expired")
+
+// ErrInvalidL402Header is returned when a 402 response carries a
+// WWW-Authenticate header that isn't a usable L402 challenge. The 402
+// response is returned alongside the error.
+var ErrInvalidL402Header = errors.New("satgate: invalid L402 header")
+
+// ErrPaymentFailed is returned when the wallet fails to pay an invoice. The
+// wallet's own error is wrapped too, so errors.As can extract a WalletError.
+var ErrPaymentFailed = errors.New("satgate: payment failed")
+
+// ErrWrongNetwork is returned when an invoice is for a different network than
+// the one set with WithExpectedNetwork. It is not paid.
+var ErrWrongNetwork = errors.New("satgate: invoice is for the wrong network")
+
+// ErrKeysendUnsupported is returned when a server asks for a keysend payment
+// but the wallet doesn't implement KeysendWallet.
+var ErrKeysendUnsupported = errors.New("satgate: wallet does not support keysend")
+
+// ErrPaymentTimeout is returned when the wallet doesn't answer within the
+// timeout set with WithPaymentTimeout, or when a built-in wallet's own API
+// call times out after the payment request was sent. The payment may still
+// complete, so it is not retried, and its amount stays reserved against the
+// budget (until the wallet answers, if it still can).
+var ErrPaymentTimeout = errors.New("satgate: payment timed out")
+
+// ErrPaymentInterrupted is returned when the request's context is cancelled
+// or reaches its deadline while the wallet is paying. It wraps the context's
+// error. As with ErrPaymentTimeout, the payment may still complete, so its
+// amount stays reserved against the budget until the wallet answers.
+var ErrPaymentInterrupted = errors.New("satgate: payment interrupted")
+
+// ErrPaymentPending is returned by the built-in wallets when the wallet
+// accepted a payment but it didn't settle within the payment timeout. The
+// payment may still complete, so it is neither retried nor tried with
+// another wallet, and the client counts its amount as spent (see
+// Stats.PendingPaymentCount).
+var ErrPaymentPending = errors.New("satgate: payment still pending")
+
+// ErrNoPreimage is returned by the built-in wallets when the wallet reports
+// success but doesn't return a preimage.
+var ErrNoPreimage = errors.New("satgate: wallet returned no preimage")
+
+// WalletError is returned by the built-in wallets when the wallet API
+// answers with an unsuccessful HTTP status.
+type WalletError struct {
+	Wallet     string // e.g. "LNBits"
+	StatusCode int
+	Message    string // the API's error message, if the body is JSON with one
+	Body       string // start of the response body
+}
+
+// Error reports the API's message if it gave one, else the body; an HTML
+// error page (e.g. from a reverse proxy) is reduced to the status text.
+func (e *WalletError) Error() string {
+	detail := e.Message
+	if detail == "" {
+		if strings.HasPrefix(e.Body, "<") {
+			detail = http.StatusText(e.StatusCode)
+		} else {
+			detail = strings.Join(strings.Fields(e.Body), " ")
+		}
+	}
+	return fmt.Sprintf("%s payment failed (HTTP %d): %s", e.Wallet, e.StatusCode, detail)
+}
+
+// ChallengeError is returned when a 402 challenge couldn't be paid, e.g.
+// because the wallet failed or a limit was hit. It carries what the server
+// sent with the challenge, which often explains the price or the failure.
+// It wraps the underlying error, so errors.Is(err, ErrPaymentFailed) and the
+// like still work.
+type ChallengeError struct {
+	StatusCode int         // status of the challenge response, usually 402
+	Header     http.Header // headers of the challenge response
+	Body       string      // start of the challenge response body
+	Err        error
+}
+
+func (e *ChallengeError) Error() string {
+	if e.Body == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (HTTP %d response: %s)", e.Err, e.StatusCode, e.Body)
+}
+
+func (e *ChallengeError) Unwrap() error { return e.Err }
+
+// ErrOffersUnsupported is returned when a server challenges with a BOLT12
+// offer but the wallet doesn't implement OfferWallet.
+var ErrOffersUnsupported = errors.New("satgate: wallet does not support BOLT12 offers")
+
+// ErrResponseTooLarge is returned when reading a response body past the
+// limit set with WithMaxResponseBytes.
+var ErrResponseTooLarge = errors.New("satgate: response body too large")
@@ -0,0 +1,89 @@
+package satgate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ============================================================================
+// Failover Wallet
+// ============================================================================
+
+// FailoverWallet pays through the first of several wallets that succeeds,
+// e.g. an LNBits wallet backed by an Alby one.
+//
+// It only moves on to the next wallet when a failure shows the payment was
+// never made (see IsPreSettlementError). Any other error is returned at once,
+// since the invoice may already be paid and paying it again elsewhere would
+// pay twice.
+type FailoverWallet struct {
+	Wallets []LightningWallet
+}
+
+// NewFailoverWallet creates a wallet that tries wallets in order.
+func NewFailoverWallet(wallets ...LightningWallet) *FailoverWallet {
+	return &FailoverWallet{Wallets: wallets}
+}
+
+// PayInvoice pays invoice with the first wallet that succeeds. If every
+// wallet fails, the returned error joins all of their errors.
+func (w *FailoverWallet) PayInvoice(invoice string) (string, error) {
+	return w.PayInvoiceCtx(context.Background(), invoice)
+}
+
+// PayInvoiceCtx is PayInvoice, passing ctx on to wallets that are
+// ContextWallets. No further wallet is tried once ctx is done.
+func (w *FailoverWallet) PayInvoiceCtx(ctx context.Context, invoice string) (string, error) {
+	result, err := w.payInvoiceDetailed(ctx, invoice)
+	return result.Preimage, err
+}
+
+// PayInvoiceDetailed is PayInvoice, also reporting the routing fee if the
+// wallet that paid is a DetailedWallet.
+func (w *FailoverWallet) PayInvoiceDetailed(invoice string) (PaymentResult, error) {
+	return w.payInvoiceDetailed(context.Background(), invoice)
+}
+
+func (w *FailoverWallet) payInvoiceDetailed(ctx context.Context, invoice string) (PaymentResult, error) {
+	if len(w.Wallets) == 0 {
+		return PaymentResult{}, errors.New("failover wallet has no wallets")
+	}
+
+	var errs []error
+	for i, wallet := range w.Wallets {
+		result, err := payDetailed(ctx, wallet, invoice)
+		if err == nil {
+			return result, nil
+		}
+		errs = append(errs, fmt.Errorf("wallet %d: %w", i, err))
+		if !IsPreSettlementError(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return PaymentResult{}, errors.Join(errs...)
+}
+
+// Close closes every wallet that implements io.Closer.
+func (w *FailoverWallet) Close() error {
+	var errs []error
+	for _, wallet := range w.Wallets {
+		if closer, ok := wallet.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsPreSettlementError reports whether err shows that a payment was certainly
+// not made, so that trying again (with the same or another wallet) can't pay
+// twice: a retryable error (see TransientError), ErrInsufficientBalance, or a
+// WalletError with a 4xx status, i.e. a request the wallet refused outright.
+func IsPreSettlementError(err error) bool {
+	if isRetryable(err) || errors.Is(err, ErrInsufficientBalance) {
+		return true
+	}
+	var walletErr *WalletError
+	return errors.As(err, &walletErr) && walletErr.StatusCode >= 400 && walletErr.StatusCode < 500
+}
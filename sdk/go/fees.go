@@ -0,0 +1,49 @@
+package satgate
+
+import "context"
+
+// ============================================================================
+// Routing Fees
+// ============================================================================
+
+// PaymentResult is the outcome of a payment made by a DetailedWallet.
+type PaymentResult struct {
+	Preimage string // hex
+	FeeSat   int64  // routing fee paid on top of the invoice amount
+}
+
+// DetailedWallet is implemented by wallets that can report what a payment
+// cost in routing fees. LNDWallet, LNBitsWallet and AlbyWallet implement it,
+// and FailoverWallet, RoutingWallet and LNURLWallet pass it through. The
+// client pays through PayInvoiceDetailed when a wallet has it, and records
+// the fee in PaymentInfo.FeeSat and Stats.FeeSat.
+type DetailedWallet interface {
+	PayInvoiceDetailed(invoice string) (PaymentResult, error)
+}
+
+// payDetailed pays invoice with wallet, through the richest method it has:
+// the fee is reported by a DetailedWallet and 0 otherwise, and ctx is only
+// seen by a ContextWallet. A custom wallet that is both is paid through
+// PayInvoiceCtx, so cancellation wins over fee reporting.
+func payDetailed(ctx context.Context, wallet LightningWallet, invoice string) (PaymentResult, error) {
+	switch w := wallet.(type) {
+	case detailedContextWallet:
+		return w.payInvoiceDetailed(ctx, invoice)
+	case ContextWallet:
+		preimage, err := w.PayInvoiceCtx(ctx, invoice)
+		return PaymentResult{Preimage: preimage}, err
+	case DetailedWallet:
+		return w.PayInvoiceDetailed(invoice)
+	}
+	preimage, err := wallet.PayInvoice(invoice)
+	return PaymentResult{Preimage: preimage}, err
+}
+
+// feeSatFromMsat converts a fee in millisatoshis, which some wallets report
+// as a negative amount for outgoing payments, to satoshis.
+func feeSatFromMsat(msat int64) int64 {
+	if msat < 0 {
+		msat = -msat
+	}
+	return msatToSat(msat)
+}
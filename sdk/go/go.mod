@@ -3,6 +3,12 @@ module github.com/SatGate-io/satgate/sdk/go
 go 1.21
 
 require (
-	github.com/lightningnetwork/lnd v0.17.0
+	github.com/btcsuite/btcd/btcec/v2 v2.3.2
+	github.com/gorilla/websocket v1.5.3
 )
 
+require (
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+)
@@ -0,0 +1,49 @@
+package satgate
+
+// ============================================================================
+// Payment History
+// ============================================================================
+
+// defaultHistorySize is how many payments Payments returns by default.
+const defaultHistorySize = 100
+
+// WithPaymentHistory sets how many of the most recent payments the client
+// keeps for Payments (default 100). Older payments are dropped. Zero turns
+// the history off.
+func WithPaymentHistory(size int) ClientOption {
+	return func(client *Client) {
+		client.historySize = size
+	}
+}
+
+// Payments returns the client's most recent payments, oldest first, as
+// reported to the payment callback. It is safe to call concurrently with
+// requests; the returned slice is a copy.
+func (c *Client) Payments() []PaymentInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.history) < c.historySize {
+		return append([]PaymentInfo(nil), c.history...)
+	}
+	payments := make([]PaymentInfo, 0, len(c.history))
+	payments = append(payments, c.history[c.historyNext:]...)
+	return append(payments, c.history[:c.historyNext]...)
+}
+
+// recordPayment adds info to the payment history, overwriting the oldest
+// entry once the history is full.
+func (c *Client) recordPayment(info PaymentInfo) {
+	if c.historySize <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.history) < c.historySize {
+		c.history = append(c.history, info)
+		return
+	}
+	c.history[c.historyNext] = info
+	c.historyNext = (c.historyNext + 1) % c.historySize
+}
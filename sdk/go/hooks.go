@@ -0,0 +1,29 @@
+package satgate
+
+import "net/http"
+
+// ============================================================================
+// Request and Response Hooks
+// ============================================================================
+
+// WithRequestHook calls hook on every outbound request just before it is
+// sent: the initial attempt, the authenticated retry and any refresh. hook
+// may modify the request, e.g. to add a correlation ID or sign it; the body
+// is set (and GetBody can produce a fresh copy) for hooks that need to read
+// it. An error from hook aborts the request and is returned wrapped.
+func WithRequestHook(hook func(*http.Request) error) ClientOption {
+	return func(client *Client) {
+		client.requestHook = hook
+	}
+}
+
+// WithResponseHook calls hook on every response the client receives,
+// including a 402 challenge and the response to the paid retry, before the
+// client acts on it. It is meant for policy such as recording headers or
+// checking content types, so hook must leave the body unread. An error from
+// hook closes the response and is returned wrapped instead.
+func WithResponseHook(hook func(*http.Response) error) ClientOption {
+	return func(client *Client) {
+		client.responseHook = hook
+	}
+}
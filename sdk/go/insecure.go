@@ -0,0 +1,101 @@
+package satgate
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+)
+
+// ============================================================================
+// Insecure TLS (local development only)
+// ============================================================================
+
+// WithInsecureTLS disables TLS certificate verification for the client's API
+// requests and for the self-hosted built-in wallets (LND, CLN, LNbits,
+// phoenixd), e.g. to talk to a local LND with its self-signed certificate
+// during development. Anyone on the network path can then impersonate the
+// server or node, so never enable it outside a local dev loop; prefer
+// NewLNDWalletWithCert. NewClient warns when it is enabled: through the
+// logger if one is set, and otherwise on stderr even with verbose output
+// off.
+//
+// Like the other transport options, it has no effect on the client passed to
+// WithHTTPClient, and it changes the wallet for every client that shares it.
+func WithInsecureTLS(enabled bool) ClientOption {
+	return func(client *Client) {
+		client.insecureTLS = enabled
+	}
+}
+
+// NewLNDWalletInsecure creates an LND wallet that skips TLS certificate
+// verification (see LNDWallet.InsecureSkipVerify). It is meant for a local
+// node during development only; a client using it logs a warning.
+func NewLNDWalletInsecure(host, macaroonHex string) *LNDWallet {
+	w := NewLNDWallet(host, macaroonHex)
+	w.InsecureSkipVerify = true
+	return w
+}
+
+// insecureTLSSetter is implemented by the built-in wallets that usually talk
+// to a self-hosted node or server.
+type insecureTLSSetter interface {
+	setInsecureTLS()
+}
+
+func (w *CLNWallet) setInsecureTLS()      { setClientInsecureTLS(w.client) }
+func (w *LNBitsWallet) setInsecureTLS()   { setClientInsecureTLS(w.client) }
+func (w *PhoenixdWallet) setInsecureTLS() { setClientInsecureTLS(w.client) }
+
+func (w *LNDWallet) setInsecureTLS() {
+	w.configure(func() { w.InsecureSkipVerify = true })
+}
+
+// insecureTLS reports whether the wallet skips TLS certificate verification.
+func (w *LNDWallet) insecureTLS() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.InsecureSkipVerify
+}
+
+// setClientInsecureTLS disables certificate verification for the requests
+// client makes from now on.
+func setClientInsecureTLS(client *walletClient) {
+	client.update(func(_ *http.Client, transport *http.Transport) {
+		insecureTLSConfig(transport)
+	})
+}
+
+func insecureTLSConfig(transport *http.Transport) {
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = true
+}
+
+// applyInsecureTLS applies WithInsecureTLS and warns if TLS verification is
+// off anywhere.
+func (c *Client) applyInsecureTLS() {
+	if c.insecureTLS {
+		if c.httpClient.Transport == c.transport {
+			insecureTLSConfig(c.transport)
+		}
+		eachWallet(c.wallet, func(wallet LightningWallet) {
+			if setter, ok := wallet.(insecureTLSSetter); ok {
+				setter.setInsecureTLS()
+			}
+		})
+	}
+
+	insecureWallet := false
+	eachWallet(c.wallet, func(wallet LightningWallet) {
+		if lnd, ok := wallet.(*LNDWallet); ok && lnd.insecureTLS() {
+			insecureWallet = true
+		}
+	})
+	// Unlike most events, this is shown even with verbose output off.
+	if c.insecureTLS || insecureWallet {
+		c.logAlert(context.Background(), slog.LevelWarn, "TLS certificate verification is disabled",
+			"⚠️  WARNING: TLS certificate verification is DISABLED. Use this for local development only.")
+	}
+}
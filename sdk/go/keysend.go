@@ -0,0 +1,109 @@
+package satgate
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// Keysend Payments
+// ============================================================================
+
+// KeysendWallet is implemented by wallets that can pay a node directly by
+// its public key (keysend, also known as spontaneous payments), for servers
+// that challenge with a destination and amount instead of an invoice:
+//
+//	WWW-Authenticate: L402 macaroon="...", keysend="<node pubkey>", amount="<sats>"
+//
+// PayKeysend pays amountSat to dest (a hex-encoded node public key) and
+// returns the payment's preimage (hex). Challenging a client whose wallet
+// doesn't implement it fails with ErrKeysendUnsupported.
+type KeysendWallet interface {
+	PayKeysend(dest string, amountSat int64) (preimage string, err error)
+}
+
+// keysendWallet returns the client's wallet, or the first wallet inside it,
+// that can pay via keysend; nil if there is none.
+func (c *Client) keysendWallet() KeysendWallet {
+	var keysender KeysendWallet
+	eachWallet(c.wallet, func(wallet LightningWallet) {
+		if w, ok := wallet.(KeysendWallet); ok && keysender == nil {
+			keysender = w
+		}
+	})
+	return keysender
+}
+
+// keysendHint is how a keysend challenge travels in place of an invoice,
+// e.g. through OnChallenge and the payment approval callback:
+// "keysend:<pubkey>?amount=<sats>".
+func keysendHint(dest string, amountSat int64) string {
+	return fmt.Sprintf("keysend:%s?amount=%d", dest, amountSat)
+}
+
+// parseKeysendHint reverses keysendHint.
+func parseKeysendHint(hint string) (dest string, amountSat int64, ok bool) {
+	rest, ok := strings.CutPrefix(hint, "keysend:")
+	if !ok {
+		return "", 0, false
+	}
+	dest, amount, ok := strings.Cut(rest, "?amount=")
+	if !ok {
+		return "", 0, false
+	}
+	amountSat, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return dest, amountSat, true
+}
+
+// keysendChallenge validates the destination and amount of a keysend
+// challenge and returns its hint.
+func keysendChallenge(dest, amount string) (string, error) {
+	if pubkey, err := hex.DecodeString(dest); err != nil || len(pubkey) != 33 {
+		return "", fmt.Errorf("keysend destination %q is not a node public key", dest)
+	}
+	amountSat, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil || amountSat <= 0 {
+		return "", fmt.Errorf("invalid keysend amount %q", amount)
+	}
+	return keysendHint(strings.ToLower(dest), amountSat), nil
+}
+
+// keysendRecordType is the TLV record carrying a keysend payment's preimage.
+const keysendRecordType = "5482373484"
+
+// PayKeysend pays amountSat to the node dest via keysend. The preimage is
+// generated here and sent to the destination in the keysend TLV record.
+func (w *LNDWallet) PayKeysend(dest string, amountSat int64) (string, error) {
+	pubkey, err := hex.DecodeString(dest)
+	if err != nil || len(pubkey) != 33 {
+		return "", fmt.Errorf("invalid keysend destination %q", dest)
+	}
+
+	preimage := make([]byte, 32)
+	if _, err := rand.Read(preimage); err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(preimage)
+
+	_, err = w.sendPayment(context.Background(), map[string]interface{}{
+		"dest":         base64.StdEncoding.EncodeToString(pubkey),
+		"amt":          strconv.FormatInt(amountSat, 10),
+		"payment_hash": base64.StdEncoding.EncodeToString(hash[:]),
+		"dest_custom_records": map[string]string{
+			keysendRecordType: base64.StdEncoding.EncodeToString(preimage),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(preimage), nil
+}
@@ -0,0 +1,44 @@
+package satgate
+
+import (
+	"fmt"
+	"io"
+)
+
+// ============================================================================
+// Response Size Limit
+// ============================================================================
+
+// WithMaxResponseBytes caps how much of a response body the client lets the
+// caller read, as a guard against an untrusted server answering with an
+// enormous body once paid. Reading past n bytes fails with
+// ErrResponseTooLarge. Zero, the default, means no limit.
+func WithMaxResponseBytes(n int64) ClientOption {
+	return func(client *Client) {
+		client.maxResponseBytes = n
+	}
+}
+
+// limitedBody fails reads once more than remaining bytes have been read.
+type limitedBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Only an error if there really is more.
+		var probe [1]byte
+		if n, err := b.ReadCloser.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%w: body exceeds %d bytes", ErrResponseTooLarge, b.limit)
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,220 @@
+package satgate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// LNURL-pay / Lightning Address Wallet
+// ============================================================================
+
+// InvoiceResolver is implemented by wallets that can turn a payment hint that
+// isn't a BOLT11 invoice (e.g. a Lightning Address) into one. The client
+// resolves such hints before checking limits and paying, so the resolved
+// invoice is what gets decoded, budgeted and verified.
+type InvoiceResolver interface {
+	ResolveInvoice(input string) (string, error)
+}
+
+// resolveInvoice resolves a payment hint with the client's wallet, or the
+// first wallet inside it that implements InvoiceResolver. Without one,
+// invoice is returned unchanged.
+func (c *Client) resolveInvoice(invoice string) (string, error) {
+	var resolver InvoiceResolver
+	eachWallet(c.wallet, func(wallet LightningWallet) {
+		if w, ok := wallet.(InvoiceResolver); ok && resolver == nil {
+			resolver = w
+		}
+	})
+	if resolver == nil {
+		return invoice, nil
+	}
+	return resolver.ResolveInvoice(invoice)
+}
+
+// LNURLWallet wraps another wallet so that it can also pay LNURL-pay
+// endpoints and Lightning Addresses (user@domain). BOLT11 invoices are passed
+// straight to the inner wallet.
+type LNURLWallet struct {
+	Inner LightningWallet
+
+	// AmountMsat is the amount requested from LNURL-pay endpoints. If zero,
+	// the endpoint's minimum (minSendable) is used.
+	AmountMsat int64
+
+	client *walletClient
+}
+
+// NewLNURLWallet creates a wallet that resolves LNURLs and Lightning Addresses
+// to BOLT11 invoices and pays them with inner.
+func NewLNURLWallet(inner LightningWallet) *LNURLWallet {
+	return &LNURLWallet{
+		Inner:  inner,
+		client: newWalletClient(30 * time.Second),
+	}
+}
+
+// PayInvoice pays a BOLT11 invoice, LNURL or Lightning Address via the inner
+// wallet.
+func (w *LNURLWallet) PayInvoice(invoice string) (string, error) {
+	return w.PayInvoiceCtx(context.Background(), invoice)
+}
+
+// PayInvoiceCtx is PayInvoice, passing ctx on to the inner wallet if it is a
+// ContextWallet.
+func (w *LNURLWallet) PayInvoiceCtx(ctx context.Context, invoice string) (string, error) {
+	result, err := w.payInvoiceDetailed(ctx, invoice)
+	return result.Preimage, err
+}
+
+// PayInvoiceDetailed is PayInvoice, also reporting the routing fee if the
+// inner wallet is a DetailedWallet.
+func (w *LNURLWallet) PayInvoiceDetailed(invoice string) (PaymentResult, error) {
+	return w.payInvoiceDetailed(context.Background(), invoice)
+}
+
+func (w *LNURLWallet) payInvoiceDetailed(ctx context.Context, invoice string) (PaymentResult, error) {
+	invoice, err := w.ResolveInvoice(invoice)
+	if err != nil {
+		return PaymentResult{}, err
+	}
+	return payDetailed(ctx, w.Inner, invoice)
+}
+
+// ResolveInvoice returns input unchanged if it is a BOLT11 invoice. An LNURL
+// (bech32 "lnurl1..." or LUD-17 "lnurlp://") or Lightning Address is resolved
+// via the LNURL-pay protocol into an invoice for AmountMsat.
+func (w *LNURLWallet) ResolveInvoice(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if _, err := invoiceAmountMsat(input); err == nil {
+		return input, nil
+	}
+
+	endpoint, err := lnurlEndpoint(input)
+	if err != nil {
+		return "", err
+	}
+
+	var params struct {
+		Tag         string `json:"tag"`
+		Callback    string `json:"callback"`
+		MinSendable int64  `json:"minSendable"`
+		MaxSendable int64  `json:"maxSendable"`
+	}
+	if err := w.getJSON(endpoint, &params); err != nil {
+		return "", err
+	}
+	if params.Tag != "payRequest" || params.Callback == "" {
+		return "", fmt.Errorf("LNURL endpoint is not a payRequest (tag %q)", params.Tag)
+	}
+
+	amountMsat := w.AmountMsat
+	if amountMsat == 0 {
+		amountMsat = params.MinSendable
+	}
+	if amountMsat < params.MinSendable || amountMsat > params.MaxSendable {
+		return "", fmt.Errorf("LNURL amount %d msat outside accepted range %d-%d msat",
+			amountMsat, params.MinSendable, params.MaxSendable)
+	}
+
+	callback, err := url.Parse(params.Callback)
+	if err != nil {
+		return "", fmt.Errorf("invalid LNURL callback: %w", err)
+	}
+	query := callback.Query()
+	query.Set("amount", strconv.FormatInt(amountMsat, 10))
+	callback.RawQuery = query.Encode()
+
+	var result struct {
+		PR string `json:"pr"`
+	}
+	if err := w.getJSON(callback.String(), &result); err != nil {
+		return "", err
+	}
+	if result.PR == "" {
+		return "", errors.New("LNURL callback did not return an invoice")
+	}
+
+	// LUD-06: the invoice must be for the amount we asked for.
+	got, err := invoiceAmountMsat(result.PR)
+	if err != nil {
+		return "", fmt.Errorf("LNURL callback returned an invalid invoice: %w", err)
+	}
+	if got != amountMsat {
+		return "", fmt.Errorf("LNURL invoice is for %d msat, requested %d msat", got, amountMsat)
+	}
+	return result.PR, nil
+}
+
+// getJSON fetches an LNURL endpoint into v, surfacing LNURL error responses.
+func (w *LNURLWallet) getJSON(endpoint string, v interface{}) error {
+	resp, err := w.client.Get(endpoint)
+	if err != nil {
+		return fmt.Errorf("LNURL request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("LNURL endpoint returned HTTP %d with invalid JSON: %w", resp.StatusCode, err)
+	}
+
+	var status struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	_ = json.Unmarshal(raw, &status)
+	if strings.EqualFold(status.Status, "ERROR") {
+		return fmt.Errorf("LNURL error: %s", status.Reason)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("LNURL endpoint returned HTTP %d", resp.StatusCode)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// lnurlEndpoint turns an LNURL or Lightning Address into the HTTPS URL of its
+// LNURL-pay endpoint.
+func lnurlEndpoint(input string) (string, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(input, "lightning:"), "LIGHTNING:")
+
+	// Lightning Address (LUD-16): user@domain
+	if user, domain, ok := strings.Cut(s, "@"); ok && user != "" && domain != "" && !strings.Contains(domain, "/") {
+		scheme := "https"
+		if strings.HasSuffix(domain, ".onion") {
+			scheme = "http"
+		}
+		return fmt.Sprintf("%s://%s/.well-known/lnurlp/%s", scheme, domain, url.PathEscape(strings.ToLower(user))), nil
+	}
+
+	// LUD-17 scheme prefix
+	if rest, ok := strings.CutPrefix(strings.ToLower(s), "lnurlp://"); ok {
+		return "https://" + s[len(s)-len(rest):], nil
+	}
+
+	// Bech32-encoded LNURL (LUD-01)
+	if strings.HasPrefix(strings.ToLower(s), "lnurl1") {
+		hrp, data, err := bech32Decode(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid LNURL: %w", err)
+		}
+		if hrp != "lnurl" {
+			return "", fmt.Errorf("invalid LNURL prefix %q", hrp)
+		}
+		decoded, err := convertBits(data, 5, 8, false)
+		if err != nil {
+			return "", fmt.Errorf("invalid LNURL: %w", err)
+		}
+		return string(decoded), nil
+	}
+
+	return "", fmt.Errorf("not a BOLT11 invoice, LNURL or Lightning Address: %q", abbreviate(input, 20, 0))
+}
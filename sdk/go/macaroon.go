@@ -0,0 +1,179 @@
+package satgate
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Macaroon Caveat Parsing
+// ============================================================================
+
+// Macaroon binary format field types (V2).
+const (
+	macaroonFieldEOS        = 0
+	macaroonFieldIdentifier = 2
+)
+
+// macaroonCaveats decodes a base64 (standard or URL-safe) macaroon in either
+// the V1 or V2 binary format and returns its caveat identifiers. Only the
+// caveats are extracted; the signature is not checked, since that requires
+// the server's root key.
+func macaroonCaveats(mac string) ([]string, error) {
+	data, err := decodeBase64Any(strings.TrimSpace(mac))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty macaroon")
+	}
+	if data[0] == 2 {
+		return macaroonCaveatsV2(data[1:])
+	}
+	return macaroonCaveatsV1(data)
+}
+
+// macaroonCaveatsV2 parses the V2 binary format: a header section, a series
+// of caveat sections and the signature, each section being a list of
+// (type, length, value) fields terminated by an EOS field.
+func macaroonCaveatsV2(data []byte) ([]string, error) {
+	readField := func() (byte, []byte, error) {
+		if len(data) == 0 {
+			return 0, nil, errors.New("truncated macaroon")
+		}
+		fieldType := data[0]
+		data = data[1:]
+		if fieldType == macaroonFieldEOS {
+			return fieldType, nil, nil
+		}
+		length, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < length {
+			return 0, nil, errors.New("truncated macaroon field")
+		}
+		value := data[n : n+int(length)]
+		data = data[n+int(length):]
+		return fieldType, value, nil
+	}
+
+	// Header: [location] identifier EOS.
+	for {
+		fieldType, _, err := readField()
+		if err != nil {
+			return nil, err
+		}
+		if fieldType == macaroonFieldEOS {
+			break
+		}
+	}
+
+	// Caveats: ([location] identifier [vid] EOS)* EOS.
+	var caveats []string
+	for {
+		var id []byte
+		fields := 0
+		for {
+			fieldType, value, err := readField()
+			if err != nil {
+				return nil, err
+			}
+			if fieldType == macaroonFieldEOS {
+				break
+			}
+			fields++
+			if fieldType == macaroonFieldIdentifier {
+				id = value
+			}
+		}
+		if fields == 0 {
+			return caveats, nil
+		}
+		caveats = append(caveats, string(id))
+	}
+}
+
+// macaroonCaveatsV1 parses the V1 (libmacaroons) format: packets of a
+// four-hex-digit length followed by "key value\n".
+func macaroonCaveatsV1(data []byte) ([]string, error) {
+	var caveats []string
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("truncated macaroon packet")
+		}
+		size, err := strconv.ParseUint(string(data[:4]), 16, 16)
+		if err != nil || size < 5 || int(size) > len(data) {
+			return nil, errors.New("invalid macaroon packet")
+		}
+		packet := string(data[4:size])
+		data = data[size:]
+
+		key, value, ok := strings.Cut(strings.TrimSuffix(packet, "\n"), " ")
+		if !ok {
+			return nil, errors.New("invalid macaroon packet")
+		}
+		if key == "cid" {
+			caveats = append(caveats, value)
+		}
+	}
+	return caveats, nil
+}
+
+// macaroonExpiry returns the earliest expiry declared by the macaroon's
+// caveats. It understands "expires_at=", "valid_until=" and aperture-style
+// "<service>_valid_until=" conditions (Unix seconds or RFC 3339), plus the
+// libmacaroons "time < <RFC 3339>" form. ok is false if the macaroon can't be
+// parsed or declares no expiry.
+func macaroonExpiry(mac string) (expiry time.Time, ok bool) {
+	caveats, err := macaroonCaveats(mac)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	for _, caveat := range caveats {
+		var value string
+		if key, v, found := strings.Cut(caveat, "="); found {
+			key = strings.TrimSpace(key)
+			if key != "expires_at" && key != "valid_until" && !strings.HasSuffix(key, "_valid_until") {
+				continue
+			}
+			value = v
+		} else if v, found := strings.CutPrefix(caveat, "time < "); found {
+			value = v
+		} else {
+			continue
+		}
+
+		t, err := parseCaveatTime(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		if !ok || t.Before(expiry) {
+			expiry, ok = t, true
+		}
+	}
+	return expiry, ok
+}
+
+func parseCaveatTime(value string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// decodeBase64Any decodes standard or URL-safe base64, padded or not. Hex is
+// also accepted, since some servers send macaroons hex-encoded.
+func decodeBase64Any(s string) ([]byte, error) {
+	if b, err := hex.DecodeString(s); err == nil {
+		return b, nil
+	}
+	s = strings.TrimRight(s, "=")
+	if b, err := base64.RawStdEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,126 @@
+package satgate
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMacaroonCaveats(t *testing.T) {
+	v2 := macaroonV2("id", "service=premium", "expires_at=1700000000")
+	v1 := macaroonV1("id", "service=premium", "time < 2023-11-14T22:13:20Z")
+
+	tests := []struct {
+		name    string
+		mac     string
+		caveats []string
+		wantErr bool
+	}{
+		{name: "V2", mac: base64.StdEncoding.EncodeToString(v2), caveats: []string{"service=premium", "expires_at=1700000000"}},
+		{name: "V2 URL-safe unpadded", mac: base64.RawURLEncoding.EncodeToString(v2), caveats: []string{"service=premium", "expires_at=1700000000"}},
+		{name: "V2 hex", mac: hex.EncodeToString(v2), caveats: []string{"service=premium", "expires_at=1700000000"}},
+		{name: "V2 no caveats", mac: base64.StdEncoding.EncodeToString(macaroonV2("id"))},
+		{name: "V2 third-party caveat", mac: base64.StdEncoding.EncodeToString(v2ThirdParty), caveats: []string{"third-party"}},
+		{name: "V1", mac: base64.URLEncoding.EncodeToString(v1), caveats: []string{"service=premium", "time < 2023-11-14T22:13:20Z"}},
+		{name: "V1 no caveats", mac: base64.StdEncoding.EncodeToString(macaroonV1("id"))},
+		{name: "empty", mac: "", wantErr: true},
+		{name: "not base64", mac: "!!!", wantErr: true},
+		{name: "V2 truncated", mac: base64.StdEncoding.EncodeToString(v2[:len(v2)-40]), wantErr: true},
+		{name: "V2 field past end", mac: base64.StdEncoding.EncodeToString([]byte{2, 2, 10, 'i', 'd'}), wantErr: true},
+		{name: "V1 truncated", mac: base64.StdEncoding.EncodeToString(v1[:len(v1)-10]), wantErr: true},
+		{name: "V1 bad length", mac: base64.StdEncoding.EncodeToString([]byte("zzzzcid x\n")), wantErr: true},
+		{name: "V1 no separator", mac: base64.StdEncoding.EncodeToString([]byte("000acidxxx\n")), wantErr: true},
+	}
+	for _, tt := range tests {
+		caveats, err := macaroonCaveats(tt.mac)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: macaroonCaveats = %q, want an error", tt.name, caveats)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(caveats, tt.caveats) {
+			t.Errorf("%s: macaroonCaveats = %q, %v; want %q", tt.name, caveats, err, tt.caveats)
+		}
+	}
+}
+
+func TestMacaroonExpiry(t *testing.T) {
+	at := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name    string
+		caveats []string
+		expiry  time.Time
+		ok      bool
+	}{
+		{name: "expires_at", caveats: []string{"expires_at=1700000000"}, expiry: at, ok: true},
+		{name: "valid_until RFC 3339", caveats: []string{"valid_until = 2023-11-14T22:13:20Z"}, expiry: at, ok: true},
+		{name: "aperture service", caveats: []string{"premium_valid_until=1700000000"}, expiry: at, ok: true},
+		{name: "libmacaroons time", caveats: []string{"time < 2023-11-14T22:13:20Z"}, expiry: at, ok: true},
+		{name: "earliest wins", caveats: []string{"expires_at=1700000100", "valid_until=1700000000"}, expiry: at, ok: true},
+		{name: "unparseable skipped", caveats: []string{"expires_at=soon", "expires_at=1700000000"}, expiry: at, ok: true},
+		{name: "other caveats", caveats: []string{"service=premium", "capabilities=read"}},
+		{name: "none", caveats: nil},
+	}
+	for _, tt := range tests {
+		mac := base64.StdEncoding.EncodeToString(macaroonV2("id", tt.caveats...))
+		expiry, ok := macaroonExpiry(mac)
+		if ok != tt.ok || !expiry.Equal(tt.expiry) {
+			t.Errorf("%s: macaroonExpiry = %s, %t; want %s, %t", tt.name, expiry, ok, tt.expiry, tt.ok)
+		}
+	}
+	if _, ok := macaroonExpiry("!!!"); ok {
+		t.Error("macaroonExpiry of an invalid macaroon: ok = true")
+	}
+}
+
+// v2ThirdParty is a V2 macaroon with a third-party caveat, whose section also
+// has location and verification ID fields.
+var v2ThirdParty = func() []byte {
+	data := []byte{2}
+	data = appendMacaroonField(data, 1, "https://example.com")
+	data = appendMacaroonField(data, macaroonFieldIdentifier, "id")
+	data = append(data, macaroonFieldEOS)
+	data = appendMacaroonField(data, 1, "https://auth.example.com")
+	data = appendMacaroonField(data, macaroonFieldIdentifier, "third-party")
+	data = appendMacaroonField(data, 4, strings.Repeat("v", 48))
+	data = append(data, macaroonFieldEOS, macaroonFieldEOS)
+	return appendMacaroonField(data, 6, strings.Repeat("s", 32))
+}()
+
+// macaroonV2 encodes a macaroon with first-party caveats in the V2 binary
+// format, with a dummy signature.
+func macaroonV2(id string, caveats ...string) []byte {
+	data := []byte{2}
+	data = appendMacaroonField(data, macaroonFieldIdentifier, id)
+	data = append(data, macaroonFieldEOS)
+	for _, caveat := range caveats {
+		data = appendMacaroonField(data, macaroonFieldIdentifier, caveat)
+		data = append(data, macaroonFieldEOS)
+	}
+	data = append(data, macaroonFieldEOS)
+	return appendMacaroonField(data, 6, strings.Repeat("s", 32))
+}
+
+func appendMacaroonField(data []byte, fieldType byte, value string) []byte {
+	data = binary.AppendUvarint(append(data, fieldType), uint64(len(value)))
+	return append(data, value...)
+}
+
+// macaroonV1 encodes a macaroon with first-party caveats in the V1 format,
+// with a dummy signature.
+func macaroonV1(id string, caveats ...string) []byte {
+	packet := func(key, value string) string {
+		return fmt.Sprintf("%04x%s %s\n", 4+len(key)+1+len(value)+1, key, value)
+	}
+	s := packet("location", "https://example.com") + packet("identifier", id)
+	for _, caveat := range caveats {
+		s += packet("cid", caveat)
+	}
+	return []byte(s + packet("signature", strings.Repeat("s", 32)))
+}
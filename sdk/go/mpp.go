@@ -0,0 +1,37 @@
+package satgate
+
+// ============================================================================
+// Multi-Part Payments
+// ============================================================================
+
+// defaultMaxParts is how many parts LNDWallet lets a payment be split into
+// unless MaxParts says otherwise, matching lncli's default.
+const defaultMaxParts = 16
+
+// WithMaxParts sets MaxParts on the LND wallets in the client's wallet
+// (including those inside a FailoverWallet, RoutingWallet or LNURLWallet):
+// how many parts a payment may be split into when no single route can
+// carry it. 1 disables splitting. Other wallets split payments as their
+// node or service decides.
+func WithMaxParts(n int) ClientOption {
+	return func(client *Client) {
+		client.maxParts = n
+	}
+}
+
+// setWalletMaxParts sets MaxParts on the LND wallets in wallet.
+func setWalletMaxParts(wallet LightningWallet, n int) {
+	eachWallet(wallet, func(wallet LightningWallet) {
+		if lnd, ok := wallet.(*LNDWallet); ok {
+			lnd.MaxParts = n
+		}
+	})
+}
+
+// maxParts returns the multi-part payment limit to ask LND for.
+func (w *LNDWallet) maxParts() int {
+	if w.MaxParts > 0 {
+		return w.MaxParts
+	}
+	return defaultMaxParts
+}
@@ -0,0 +1,68 @@
+package satgate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ============================================================================
+// Invoice Network Check
+// ============================================================================
+
+// bolt11Networks maps BOLT11 currency prefixes to network names.
+var bolt11Networks = map[string]string{
+	"bc":   "mainnet",
+	"tb":   "testnet",
+	"tbs":  "signet",
+	"bcrt": "regtest",
+	"sb":   "simnet",
+}
+
+// WithExpectedNetwork makes the client refuse invoices for any other network
+// ("mainnet", "testnet", "signet" or "regtest"), judged by the invoice
+// prefix (lnbc, lntb, lntbs, lnbcrt) or by a BOLT12 invoice's chain. A
+// mismatch fails with ErrWrongNetwork before anything is paid. By default
+// invoices for any network are accepted.
+func WithExpectedNetwork(network string) ClientOption {
+	return func(client *Client) {
+		client.expectedNetwork = strings.ToLower(network)
+	}
+}
+
+// invoiceNetwork returns the network a BOLT11 or BOLT12 invoice is for.
+func invoiceNetwork(invoice string) (string, error) {
+	if isBolt12Invoice(invoice) {
+		decoded, err := decodeBolt12Invoice(invoice)
+		if err != nil {
+			return "", err
+		}
+		return decoded.network()
+	}
+	invoice = strings.ToLower(strings.TrimSpace(invoice))
+	invoice = strings.TrimPrefix(invoice, "lightning:")
+	if !strings.HasPrefix(invoice, "ln") {
+		return "", fmt.Errorf("not a BOLT11 invoice")
+	}
+	for _, cur := range bolt11Currencies {
+		if strings.HasPrefix(invoice[2:], cur) {
+			return bolt11Networks[cur], nil
+		}
+	}
+	return "", fmt.Errorf("unknown invoice currency prefix")
+}
+
+// checkNetwork returns ErrWrongNetwork if invoice is not for the network set
+// with WithExpectedNetwork.
+func (c *Client) checkNetwork(invoice string) error {
+	if c.expectedNetwork == "" {
+		return nil
+	}
+	network, err := invoiceNetwork(invoice)
+	if err != nil {
+		return fmt.Errorf("invalid invoice: %w", err)
+	}
+	if network != c.expectedNetwork {
+		return fmt.Errorf("%w: %s invoice, expected %s", ErrWrongNetwork, network, c.expectedNetwork)
+	}
+	return nil
+}
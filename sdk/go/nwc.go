@@ -0,0 +1,499 @@
+package satgate
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/gorilla/websocket"
+)
+
+// ============================================================================
+// Nostr Wallet Connect (NWC / NIP-47) Wallet Implementation
+// ============================================================================
+
+// Nostr event kinds used by NIP-47.
+const (
+	nwcRequestKind  = 23194
+	nwcResponseKind = 23195
+)
+
+// NWCWallet implements LightningWallet using Nostr Wallet Connect (NIP-47).
+//
+// Payment requests are encrypted to the wallet service (NIP-04) and sent over
+// a single relay connection, which is dialled on first use and kept open until
+// Close is called.
+type NWCWallet struct {
+	WalletPubkey string        // hex-encoded x-only pubkey of the wallet service
+	Relay        string        // e.g., "wss://relay.getalby.com/v1"
+	Timeout      time.Duration // how long to wait for the wallet's response
+
+	proxy        proxyFunc // set by WithProxy
+	secret       *btcec.PrivateKey
+	clientPubkey string
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	pending map[string]*nwcRequest // keyed by subscription ID
+	closed  bool
+
+	writeMu sync.Mutex
+}
+
+// nwcRequest tracks a pay_invoice request awaiting its response event.
+type nwcRequest struct {
+	eventID string
+	done    chan nwcResult
+}
+
+type nwcResult struct {
+	event *nostrEvent
+	err   error
+}
+
+// nostrEvent is a NIP-01 event.
+type nostrEvent struct {
+	ID        string     `json:"id"`
+	Pubkey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+// NewNWCWallet creates a new NWC wallet from a connection URI of the form
+// nostr+walletconnect://<wallet-pubkey>?relay=<wss-url>&secret=<hex-key>.
+func NewNWCWallet(uri string) (*NWCWallet, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NWC URI: %w", err)
+	}
+	if u.Scheme != "nostr+walletconnect" && u.Scheme != "nostrwalletconnect" {
+		return nil, fmt.Errorf("invalid NWC URI scheme %q", u.Scheme)
+	}
+
+	walletPubkey := u.Host
+	if walletPubkey == "" {
+		walletPubkey = strings.TrimPrefix(u.Opaque, "//")
+	}
+	if _, err := parseXOnlyPubkey(walletPubkey); err != nil {
+		return nil, fmt.Errorf("invalid NWC wallet pubkey: %w", err)
+	}
+
+	query := u.Query()
+	relay := query.Get("relay")
+	if relay == "" {
+		return nil, fmt.Errorf("NWC URI is missing relay")
+	}
+
+	secretBytes, err := hex.DecodeString(query.Get("secret"))
+	if err != nil || len(secretBytes) != 32 {
+		return nil, fmt.Errorf("NWC URI has an invalid secret")
+	}
+	secret, _ := btcec.PrivKeyFromBytes(secretBytes)
+
+	return &NWCWallet{
+		WalletPubkey: strings.ToLower(walletPubkey),
+		Relay:        relay,
+		Timeout:      60 * time.Second,
+		secret:       secret,
+		clientPubkey: hex.EncodeToString(schnorr.SerializePubKey(secret.PubKey())),
+		pending:      make(map[string]*nwcRequest),
+	}, nil
+}
+
+// PayInvoice pays a BOLT11 invoice by sending a pay_invoice request to the
+// wallet service and waiting for its response.
+func (w *NWCWallet) PayInvoice(invoice string) (string, error) {
+	w.mu.Lock()
+	timeout := w.Timeout
+	w.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	walletPub, err := parseXOnlyPubkey(w.WalletPubkey)
+	if err != nil {
+		return "", fmt.Errorf("invalid NWC wallet pubkey: %w", err)
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"method": "pay_invoice",
+		"params": map[string]string{"invoice": invoice},
+	})
+	content, err := nip04Encrypt(w.secret, walletPub, payload)
+	if err != nil {
+		return "", err
+	}
+
+	event, err := w.signEvent(nwcRequestKind, [][]string{{"p", w.WalletPubkey}}, content)
+	if err != nil {
+		return "", err
+	}
+
+	// Subscribe to the response before publishing so it can't be missed.
+	subID, req, err := w.subscribe(ctx, event.ID)
+	if err != nil {
+		return "", fmt.Errorf("NWC relay error: %w", err)
+	}
+	defer w.unsubscribe(subID)
+
+	if err := w.send([]interface{}{"EVENT", event}); err != nil {
+		return "", fmt.Errorf("NWC relay error: %w", err)
+	}
+
+	var result nwcResult
+	select {
+	case result = <-req.done:
+	case <-ctx.Done():
+		// The request was published, so the wallet may be paying.
+		return "", fmt.Errorf("%w: NWC wallet did not respond within %s", ErrPaymentTimeout, timeout)
+	}
+	if result.err != nil {
+		return "", fmt.Errorf("NWC relay error: %w", result.err)
+	}
+
+	plaintext, err := nip04Decrypt(w.secret, walletPub, result.event.Content)
+	if err != nil {
+		return "", fmt.Errorf("NWC response decryption failed: %w", err)
+	}
+
+	var response struct {
+		ResultType string `json:"result_type"`
+		Error      *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Result struct {
+			Preimage string `json:"preimage"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(plaintext, &response); err != nil {
+		return "", err
+	}
+
+	if response.Error != nil {
+		return "", fmt.Errorf("NWC payment failed: %s: %s", response.Error.Code, response.Error.Message)
+	}
+
+	if response.Result.Preimage == "" {
+		return "", fmt.Errorf("NWC: %w", ErrNoPreimage)
+	}
+
+	return strings.ToLower(response.Result.Preimage), nil
+}
+
+// Close closes the relay connection. Subsequent payments fail.
+func (w *NWCWallet) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// subscribe registers a subscription for the response to eventID, dialling
+// the relay first if needed.
+func (w *NWCWallet) subscribe(ctx context.Context, eventID string) (string, *nwcRequest, error) {
+	if err := w.connect(ctx); err != nil {
+		return "", nil, err
+	}
+
+	subID := randomHex(8)
+	req := &nwcRequest{eventID: eventID, done: make(chan nwcResult, 1)}
+
+	w.mu.Lock()
+	w.pending[subID] = req
+	w.mu.Unlock()
+
+	filter := map[string]interface{}{
+		"kinds":   []int{nwcResponseKind},
+		"authors": []string{w.WalletPubkey},
+		"#e":      []string{eventID},
+	}
+	if err := w.send([]interface{}{"REQ", subID, filter}); err != nil {
+		w.unsubscribe(subID)
+		return "", nil, err
+	}
+	return subID, req, nil
+}
+
+func (w *NWCWallet) unsubscribe(subID string) {
+	w.mu.Lock()
+	_, ok := w.pending[subID]
+	delete(w.pending, subID)
+	w.mu.Unlock()
+
+	if ok {
+		_ = w.send([]interface{}{"CLOSE", subID})
+	}
+}
+
+func (w *NWCWallet) connect(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errors.New("wallet is closed")
+	}
+	if w.conn != nil {
+		return nil
+	}
+
+	// Nothing has been published yet, so a relay we can't reach is safe to
+	// retry.
+	dialer := *websocket.DefaultDialer
+	if w.proxy != nil {
+		dialer.Proxy = w.proxy
+	}
+	conn, _, err := dialer.DialContext(ctx, w.Relay, nil)
+	if err != nil {
+		return &TransientError{Err: err}
+	}
+	w.conn = conn
+	go w.readLoop(conn)
+	return nil
+}
+
+func (w *NWCWallet) send(msg interface{}) error {
+	w.mu.Lock()
+	conn := w.conn
+	w.mu.Unlock()
+	if conn == nil {
+		return errors.New("not connected")
+	}
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	return conn.WriteJSON(msg)
+}
+
+// readLoop dispatches relay messages to pending requests until the
+// connection fails, then fails everything still waiting on it.
+func (w *NWCWallet) readLoop(conn *websocket.Conn) {
+	for {
+		var msg []json.RawMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			w.dropConn(conn, err)
+			return
+		}
+		if len(msg) < 2 {
+			continue
+		}
+
+		var kind string
+		if err := json.Unmarshal(msg[0], &kind); err != nil {
+			continue
+		}
+
+		switch kind {
+		case "EVENT":
+			if len(msg) < 3 {
+				continue
+			}
+			var subID string
+			var event nostrEvent
+			if json.Unmarshal(msg[1], &subID) != nil || json.Unmarshal(msg[2], &event) != nil {
+				continue
+			}
+			if event.Pubkey != w.WalletPubkey || !verifyEvent(&event) {
+				continue
+			}
+			w.resolve(func(id string, _ *nwcRequest) bool { return id == subID }, nwcResult{event: &event})
+
+		case "OK":
+			// ["OK", <event id>, <accepted>, <message>]
+			if len(msg) < 3 {
+				continue
+			}
+			var eventID, message string
+			var accepted bool
+			_ = json.Unmarshal(msg[1], &eventID)
+			_ = json.Unmarshal(msg[2], &accepted)
+			if len(msg) > 3 {
+				_ = json.Unmarshal(msg[3], &message)
+			}
+			if !accepted {
+				err := fmt.Errorf("relay rejected request: %s", message)
+				w.resolve(func(_ string, r *nwcRequest) bool { return r.eventID == eventID }, nwcResult{err: err})
+			}
+
+		case "CLOSED":
+			var subID, message string
+			_ = json.Unmarshal(msg[1], &subID)
+			if len(msg) > 2 {
+				_ = json.Unmarshal(msg[2], &message)
+			}
+			err := fmt.Errorf("relay closed subscription: %s", message)
+			w.resolve(func(id string, _ *nwcRequest) bool { return id == subID }, nwcResult{err: err})
+		}
+	}
+}
+
+// resolve delivers result to every pending request matched by match.
+func (w *NWCWallet) resolve(match func(subID string, req *nwcRequest) bool, result nwcResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for subID, req := range w.pending {
+		if match(subID, req) {
+			select {
+			case req.done <- result:
+			default:
+			}
+		}
+	}
+}
+
+func (w *NWCWallet) dropConn(conn *websocket.Conn, err error) {
+	conn.Close()
+
+	w.mu.Lock()
+	if w.conn == conn {
+		w.conn = nil
+	}
+	w.mu.Unlock()
+
+	w.resolve(func(string, *nwcRequest) bool { return true }, nwcResult{err: err})
+}
+
+// signEvent builds and signs a NIP-01 event from the client key.
+func (w *NWCWallet) signEvent(kind int, tags [][]string, content string) (*nostrEvent, error) {
+	event := &nostrEvent{
+		Pubkey:    w.clientPubkey,
+		CreatedAt: time.Now().Unix(),
+		Kind:      kind,
+		Tags:      tags,
+		Content:   content,
+	}
+
+	id := eventID(event)
+	sig, err := schnorr.Sign(w.secret, id[:])
+	if err != nil {
+		return nil, err
+	}
+
+	event.ID = hex.EncodeToString(id[:])
+	event.Sig = hex.EncodeToString(sig.Serialize())
+	return event, nil
+}
+
+// eventID computes the NIP-01 event ID: the SHA-256 of the serialized
+// [0, pubkey, created_at, kind, tags, content] array.
+func eventID(event *nostrEvent) [32]byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode([]interface{}{0, event.Pubkey, event.CreatedAt, event.Kind, event.Tags, event.Content})
+	return sha256.Sum256(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// verifyEvent checks an event's ID and Schnorr signature.
+func verifyEvent(event *nostrEvent) bool {
+	id := eventID(event)
+	if hex.EncodeToString(id[:]) != event.ID {
+		return false
+	}
+
+	pub, err := parseXOnlyPubkey(event.Pubkey)
+	if err != nil {
+		return false
+	}
+	sigBytes, err := hex.DecodeString(event.Sig)
+	if err != nil {
+		return false
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return false
+	}
+	return sig.Verify(id[:], pub)
+}
+
+func parseXOnlyPubkey(pubkeyHex string) (*btcec.PublicKey, error) {
+	b, err := hex.DecodeString(pubkeyHex)
+	if err != nil {
+		return nil, err
+	}
+	return schnorr.ParsePubKey(b)
+}
+
+// nip04Encrypt encrypts plaintext for pub using NIP-04 (AES-256-CBC keyed
+// with the ECDH shared x-coordinate).
+func nip04Encrypt(priv *btcec.PrivateKey, pub *btcec.PublicKey, plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(btcec.GenerateSharedSecret(priv, pub))
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	return base64.StdEncoding.EncodeToString(ciphertext) + "?iv=" + base64.StdEncoding.EncodeToString(iv), nil
+}
+
+// nip04Decrypt reverses nip04Encrypt.
+func nip04Decrypt(priv *btcec.PrivateKey, pub *btcec.PublicKey, content string) ([]byte, error) {
+	ctB64, ivB64, ok := strings.Cut(content, "?iv=")
+	if !ok {
+		return nil, errors.New("missing iv")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(ctB64)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := base64.StdEncoding.DecodeString(ivB64)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("malformed ciphertext")
+	}
+
+	block, err := aes.NewCipher(btcec.GenerateSharedSecret(priv, pub))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plaintext) {
+		return nil, errors.New("invalid padding")
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,100 @@
+package satgate
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+func TestNIP04RoundTrip(t *testing.T) {
+	alice, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{1}, 32))
+	bob, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{2}, 32))
+
+	for _, n := range []int{0, 1, 15, 16, 17, 1000} {
+		plaintext := bytes.Repeat([]byte("x"), n)
+		content, err := nip04Encrypt(alice, bob.PubKey(), plaintext)
+		if err != nil {
+			t.Fatalf("nip04Encrypt(%d bytes): %v", n, err)
+		}
+		got, err := nip04Decrypt(bob, alice.PubKey(), content)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("round trip of %d bytes = %q, %v", n, got, err)
+		}
+		// A wrong key usually leaves invalid padding; it must never yield
+		// the plaintext.
+		if got, err := nip04Decrypt(bob, bob.PubKey(), content); err == nil && n > 0 && bytes.Equal(got, plaintext) {
+			t.Errorf("%d bytes decrypted with the wrong key", n)
+		}
+	}
+
+	again, _ := nip04Encrypt(alice, bob.PubKey(), []byte("x"))
+	first, _ := nip04Encrypt(alice, bob.PubKey(), []byte("x"))
+	if again == first {
+		t.Error("nip04Encrypt reused an IV")
+	}
+}
+
+func TestNIP04DecryptMalformed(t *testing.T) {
+	alice, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{1}, 32))
+	bob, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{2}, 32))
+	iv := base64.StdEncoding.EncodeToString(make([]byte, aes.BlockSize))
+	block := base64.StdEncoding.EncodeToString(make([]byte, aes.BlockSize))
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "no iv", content: block},
+		{name: "bad ciphertext base64", content: "!!!?iv=" + iv},
+		{name: "bad iv base64", content: block + "?iv=!!!"},
+		{name: "short iv", content: block + "?iv=" + base64.StdEncoding.EncodeToString(make([]byte, 8))},
+		{name: "empty ciphertext", content: "?iv=" + iv},
+		{name: "partial block", content: base64.StdEncoding.EncodeToString(make([]byte, 20)) + "?iv=" + iv},
+		{name: "zero padding", content: encryptRaw(alice, bob, make([]byte, aes.BlockSize))},
+		{name: "oversized padding", content: encryptRaw(alice, bob, bytes.Repeat([]byte{17}, aes.BlockSize))},
+	}
+	for _, tt := range tests {
+		if got, err := nip04Decrypt(bob, alice.PubKey(), tt.content); err == nil {
+			t.Errorf("%s: nip04Decrypt = %q, want an error", tt.name, got)
+		}
+	}
+}
+
+func TestEventSignature(t *testing.T) {
+	w, err := NewNWCWallet("nostr+walletconnect://" + nwcTestPubkey + "?relay=wss://relay.example.com&secret=" + strings.Repeat("01", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	event, err := w.signEvent(23194, [][]string{{"p", nwcTestPubkey}}, `{"method":"pay_invoice"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifyEvent(event) {
+		t.Fatal("verifyEvent rejected a freshly signed event")
+	}
+	event.Content += " "
+	if verifyEvent(event) {
+		t.Error("verifyEvent accepted a tampered event")
+	}
+}
+
+// nwcTestPubkey is a valid x-only public key (the secp256k1 generator).
+const nwcTestPubkey = "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+
+// encryptRaw encrypts exactly one block without adding padding, so tests
+// can produce ciphertexts with invalid padding.
+func encryptRaw(priv, peer *btcec.PrivateKey, plaintext []byte) string {
+	block, _ := aes.NewCipher(btcec.GenerateSharedSecret(priv, peer.PubKey()))
+	iv := sha256.Sum256(plaintext)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv[:aes.BlockSize]).CryptBlocks(ciphertext, plaintext)
+	return base64.StdEncoding.EncodeToString(ciphertext) + "?iv=" + base64.StdEncoding.EncodeToString(iv[:aes.BlockSize])
+}
@@ -0,0 +1,53 @@
+package satgate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ============================================================================
+// BOLT12 Offers
+// ============================================================================
+
+// OfferWallet is implemented by wallets that can fetch an invoice from a
+// BOLT12 offer ("lno1..."), for servers that challenge with an offer instead
+// of an invoice:
+//
+//	WWW-Authenticate: L402 macaroon="...", offer="lno1..."
+//
+// FetchInvoiceFromOffer requests an invoice from the offer's issuer and
+// returns it: a BOLT12 invoice ("lni1...") or, from wallets that convert it,
+// a BOLT11 one. The client then decodes it, checks it against its limits,
+// pays it with the wallet and verifies the preimage like any other invoice,
+// so the wallet must also be able to pay what it returns. CLNWallet
+// implements it, also when wrapped in a FailoverWallet, RoutingWallet or
+// LNURLWallet. Challenging a client whose wallet doesn't implement it fails
+// with ErrOffersUnsupported.
+type OfferWallet interface {
+	FetchInvoiceFromOffer(offer string) (invoice string, err error)
+}
+
+// isOffer reports whether s is a BOLT12 offer.
+func isOffer(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(strings.TrimPrefix(s, "lightning:"), "lno1")
+}
+
+// fetchOfferInvoice turns a BOLT12 offer into an invoice with the client's
+// wallet, or the first wallet inside it that can.
+func (c *Client) fetchOfferInvoice(offer string) (string, error) {
+	var fetcher OfferWallet
+	eachWallet(c.wallet, func(wallet LightningWallet) {
+		if w, ok := wallet.(OfferWallet); ok && fetcher == nil {
+			fetcher = w
+		}
+	})
+	if fetcher == nil {
+		return "", ErrOffersUnsupported
+	}
+	invoice, err := fetcher.FetchInvoiceFromOffer(offer)
+	if err != nil {
+		return "", fmt.Errorf("fetching invoice from offer: %w", err)
+	}
+	return invoice, nil
+}
@@ -0,0 +1,72 @@
+package satgate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Phoenixd Wallet Implementation
+// ============================================================================
+
+// PhoenixdWallet implements LightningWallet using the phoenixd HTTP API.
+type PhoenixdWallet struct {
+	BaseURL  string // e.g., "http://localhost:9740"
+	Password string // phoenixd http-password
+	client   *walletClient
+}
+
+// NewPhoenixdWallet creates a new phoenixd wallet.
+func NewPhoenixdWallet(baseURL, password string) *PhoenixdWallet {
+	return &PhoenixdWallet{
+		BaseURL:  baseURL,
+		Password: password,
+		client:   newWalletClient(60 * time.Second),
+	}
+}
+
+// PayInvoice pays a BOLT11 invoice via phoenixd.
+func (w *PhoenixdWallet) PayInvoice(invoice string) (string, error) {
+	form := url.Values{"invoice": {invoice}}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(w.BaseURL, "/")+"/payinvoice", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	// phoenixd uses HTTP basic auth with an empty username.
+	req.SetBasicAuth("", w.Password)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", payCallError(walletRequestError("phoenixd", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", walletStatusError("phoenixd", resp)
+	}
+
+	var result struct {
+		PaymentPreimage string `json:"paymentPreimage"`
+		Reason          string `json:"reason"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	if result.PaymentPreimage == "" {
+		if result.Reason != "" {
+			return "", fmt.Errorf("phoenixd payment failed: %s", result.Reason)
+		}
+		return "", fmt.Errorf("phoenixd: %w", ErrNoPreimage)
+	}
+
+	return strings.ToLower(result.PaymentPreimage), nil
+}
@@ -0,0 +1,101 @@
+package satgate
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ============================================================================
+// Proxy Support
+// ============================================================================
+
+// proxyFunc picks the proxy for a request, as in http.Transport.Proxy.
+type proxyFunc func(*http.Request) (*url.URL, error)
+
+// WithProxy sends all traffic through the proxy at proxyURL: API requests
+// and the built-in wallets' calls alike, including NWC's relay connection.
+// Use a socks5:// URL for Tor (e.g. "socks5://127.0.0.1:9050"); host names,
+// .onion addresses included, are then resolved by the proxy. http:// and
+// https:// proxies work too.
+//
+// If proxyURL is invalid, every request fails rather than silently going
+// direct. Like the other transport options, it has no effect on the client
+// passed to WithHTTPClient, and it changes the wallet for every client that
+// shares it. Wallet calls already in progress, and an NWC relay connection
+// that is already open, keep going direct.
+func WithProxy(proxyURL string) ClientOption {
+	return func(client *Client) {
+		client.proxy = parseProxy(proxyURL)
+	}
+}
+
+func parseProxy(proxyURL string) proxyFunc {
+	u, err := url.Parse(proxyURL)
+	if err == nil && u.Host == "" {
+		err = fmt.Errorf("missing host")
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid proxy URL %q: %w", proxyURL, err)
+		return func(*http.Request) (*url.URL, error) { return nil, err }
+	}
+	return http.ProxyURL(u)
+}
+
+// proxySetter is implemented by the built-in wallets, which make their own
+// HTTP (or WebSocket) connections.
+type proxySetter interface {
+	setProxy(proxy proxyFunc)
+}
+
+// setWalletProxy routes the connections of the built-in wallets in wallet
+// through proxy.
+func setWalletProxy(wallet LightningWallet, proxy proxyFunc) {
+	eachWallet(wallet, func(wallet LightningWallet) {
+		if setter, ok := wallet.(proxySetter); ok {
+			setter.setProxy(proxy)
+		}
+	})
+}
+
+// setClientProxy routes the requests client makes from now on through proxy.
+func setClientProxy(client *walletClient, proxy proxyFunc) {
+	client.update(func(_ *http.Client, transport *http.Transport) {
+		transport.Proxy = proxy
+	})
+}
+
+func (w *LNBitsWallet) setProxy(proxy proxyFunc)   { setClientProxy(w.client, proxy) }
+func (w *AlbyWallet) setProxy(proxy proxyFunc)     { setClientProxy(w.client, proxy) }
+func (w *CLNWallet) setProxy(proxy proxyFunc)      { setClientProxy(w.client, proxy) }
+func (w *PhoenixdWallet) setProxy(proxy proxyFunc) { setClientProxy(w.client, proxy) }
+func (w *LNURLWallet) setProxy(proxy proxyFunc)    { setClientProxy(w.client, proxy) }
+
+func (w *LNDWallet) setProxy(proxy proxyFunc) {
+	w.configure(func() { w.proxy = proxy })
+}
+
+// setProxy takes effect when the relay connection is next dialled.
+func (w *NWCWallet) setProxy(proxy proxyFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.proxy = proxy
+}
+
+// eachWallet calls fn for wallet and, if it combines other wallets (e.g.
+// FailoverWallet), for each of those in turn.
+func eachWallet(wallet LightningWallet, fn func(LightningWallet)) {
+	fn(wallet)
+	switch w := wallet.(type) {
+	case *LNURLWallet:
+		eachWallet(w.Inner, fn)
+	case *FailoverWallet:
+		for _, inner := range w.Wallets {
+			eachWallet(inner, fn)
+		}
+	case *RoutingWallet:
+		for _, inner := range w.Wallets {
+			eachWallet(inner, fn)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package satgate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Spend Rate Limiting
+// ============================================================================
+
+// WithSpendRateLimit caps spending at sats per period (e.g. 100 sats per
+// minute) using a token bucket: up to sats can be spent in a burst, and the
+// allowance refills continuously at sats/per. A payment the bucket can't
+// cover fails with ErrRateLimited, or waits for the allowance to refill if
+// WithRateLimitWait(true) is set.
+func WithSpendRateLimit(sats int64, per time.Duration) ClientOption {
+	return func(client *Client) {
+		if sats <= 0 || per <= 0 {
+			client.spendLimiter = nil
+			return
+		}
+		client.spendLimiter = newSpendLimiter(sats, per)
+	}
+}
+
+// WithRateLimitWait makes a payment that exceeds the spend rate limit block
+// until enough allowance has refilled, instead of failing with
+// ErrRateLimited. The wait honours the request context.
+func WithRateLimitWait(wait bool) ClientOption {
+	return func(client *Client) {
+		client.rateLimitWait = wait
+	}
+}
+
+// spendLimiter is a token bucket measured in satoshis.
+type spendLimiter struct {
+	mu       sync.Mutex
+	capacity float64
+	perSec   float64 // refill rate, sats per second
+	tokens   float64
+	last     time.Time // zero until the first take
+}
+
+func newSpendLimiter(sats int64, per time.Duration) *spendLimiter {
+	return &spendLimiter{
+		capacity: float64(sats),
+		perSec:   float64(sats) / per.Seconds(),
+		tokens:   float64(sats),
+	}
+}
+
+// take removes amountSat from the bucket if it holds enough. Otherwise it
+// returns how long until it will, or ok=false if amountSat exceeds the
+// bucket's capacity and can never be paid.
+func (l *spendLimiter) take(amountSat int64, now time.Time) (wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	amount := float64(amountSat)
+	if amount > l.capacity {
+		return 0, false
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.perSec
+	}
+	if l.tokens > l.capacity {
+		l.tokens = l.capacity
+	}
+	l.last = now
+
+	if l.tokens >= amount {
+		l.tokens -= amount
+		return 0, true
+	}
+	return time.Duration((amount - l.tokens) / l.perSec * float64(time.Second)), true
+}
+
+// refund returns allowance taken for a payment that wasn't made.
+func (l *spendLimiter) refund(amountSat int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens += float64(amountSat)
+	if l.tokens > l.capacity {
+		l.tokens = l.capacity
+	}
+}
+
+// takeSpendAllowance charges amountSat against the spend rate limit, waiting
+// for it to refill if configured to.
+func (c *Client) takeSpendAllowance(ctx context.Context, amountSat int64) error {
+	if c.spendLimiter == nil {
+		return nil
+	}
+	for {
+		wait, ok := c.spendLimiter.take(amountSat, c.now())
+		if !ok {
+			return fmt.Errorf("%w: invoice requests %d sats, more than the limit allows in one period",
+				ErrRateLimited, amountSat)
+		}
+		if wait == 0 {
+			return nil
+		}
+		if !c.rateLimitWait {
+			return fmt.Errorf("%w: paying %d sats now would exceed the spend rate limit (retry in %s)",
+				ErrRateLimited, amountSat, wait.Round(time.Second))
+		}
+
+		c.logEvent(ctx, slog.LevelInfo, "spend rate limit reached; waiting",
+			fmt.Sprintf("⏳ Spend rate limit reached; waiting %s", wait.Round(time.Millisecond)),
+			"invoice_amount_sat", amountSat, "wait", wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// refundSpendAllowance undoes takeSpendAllowance for a payment that wasn't
+// made.
+func (c *Client) refundSpendAllowance(amountSat int64) {
+	if c.spendLimiter != nil {
+		c.spendLimiter.refund(amountSat)
+	}
+}
@@ -0,0 +1,88 @@
+package satgate
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// ============================================================================
+// Proactive Token Refresh
+// ============================================================================
+
+// refreshWindow is the fraction of the cache TTL before a token's expiry in
+// which WithProactiveRefresh replaces it.
+const refreshWindow = 0.1
+
+// WithProactiveRefresh makes the client pay for a replacement token in the
+// background when a cached token it uses is within 10% of the cache TTL of
+// expiring, so busy endpoints don't see the latency of a cache miss. The
+// current token keeps being served until the new one is cached. This pays
+// earlier than strictly necessary, so it is off by default.
+//
+// Only tokens used by GET and HEAD requests are refreshed: fetching a new
+// challenge means sending the request again without a token, and replaying
+// a POST, PUT, PATCH or DELETE could act on it if the server doesn't insist
+// on payment first. Tokens for other methods are paid for again once they
+// expire.
+func WithProactiveRefresh(enabled bool) ClientOption {
+	return func(client *Client) {
+		client.proactiveRefresh = enabled
+	}
+}
+
+// maybeRefresh starts a background refresh of the token cached for req if it
+// is a GET or HEAD, the token is about to expire and no payment for its key
+// is already in flight.
+func (c *Client) maybeRefresh(req *request, token *cachedToken) {
+	if req.method != http.MethodGet && req.method != http.MethodHead {
+		return
+	}
+	window := c.cacheTTL.Seconds() * refreshWindow
+	if token.expiresAt.Sub(c.now()).Seconds() > window {
+		return
+	}
+
+	release, _ := c.startPayment(c.keyFor(req))
+	if release == nil {
+		return // a payment or refresh for this key is already running
+	}
+
+	go func() {
+		defer release()
+		if err := c.refresh(req); err != nil {
+			c.logEvent(c.background, slog.LevelWarn, "proactive token refresh failed",
+				fmt.Sprintf("⚠️  Token refresh for %s failed: %v", req.url, err),
+				"url", req.url, "error", err)
+		}
+	}()
+}
+
+// refresh fetches a fresh challenge for req, a GET or HEAD, and pays it,
+// which caches the new token. The request is sent without a token, so the
+// server answers 402.
+func (c *Client) refresh(req *request) error {
+	ctx := c.background
+	c.logEvent(ctx, slog.LevelDebug, "refreshing L402 token",
+		fmt.Sprintf("🔁 Refreshing L402 token for %s", req.url), "url", req.url)
+
+	resp, err := c.doRequest(ctx, req, nil)
+	if err != nil {
+		return err
+	}
+	defer discardBody(resp)
+	if !c.isChallenge(resp) {
+		return fmt.Errorf("expected a 402 challenge, got HTTP %d", resp.StatusCode)
+	}
+
+	macaroon, invoice, found, err := c.readChallenge(ctx, resp)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("402 response carried no L402 challenge")
+	}
+	_, _, err = c.payChallenge(ctx, req, c.keyFor(req), resp.StatusCode, macaroon, invoice)
+	return err
+}
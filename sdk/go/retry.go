@@ -0,0 +1,158 @@
+package satgate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Payment Retry
+// ============================================================================
+
+// TransientError marks a wallet failure that is safe to retry because the
+// payment was certainly not attempted, e.g. the wallet API couldn't be
+// reached or asked the caller to back off. Custom wallets can return it (or
+// any error with a Retryable() bool method) to opt in to WithPaymentRetry.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// Retryable reports that the failed payment may be attempted again.
+func (e *TransientError) Retryable() bool { return true }
+
+// isRetryable reports whether err declares itself retryable. Errors that say
+// nothing are treated as definitive, since the payment may have gone out.
+func isRetryable(err error) bool {
+	var r interface{ Retryable() bool }
+	return errors.As(err, &r) && r.Retryable()
+}
+
+// WithPaymentRetry retries a payment up to attempts times in total when the
+// wallet fails with a retryable error, waiting baseDelay before the first
+// retry and doubling the wait each time. Only errors that report
+// Retryable() == true are retried, so a payment that may have been sent is
+// never paid twice.
+func WithPaymentRetry(attempts int, baseDelay time.Duration) ClientOption {
+	return func(client *Client) {
+		client.paymentAttempts = attempts
+		client.paymentRetryDelay = baseDelay
+	}
+}
+
+// payInvoice pays invoice with the client's wallet, retrying retryable
+// failures as configured by WithPaymentRetry. The fee is only known for a
+// DetailedWallet.
+func (c *Client) payInvoice(ctx context.Context, invoice string) (PaymentResult, error) {
+	return c.payWithRetry(ctx, func(ctx context.Context) (PaymentResult, error) {
+		return payDetailed(ctx, c.wallet, invoice)
+	})
+}
+
+// payWithRetry makes a payment with pay, a wallet call, retrying retryable
+// failures as configured by WithPaymentRetry. If ctx is done while waiting
+// to retry, the error wraps ctx.Err() and mentions the last wallet error.
+func (c *Client) payWithRetry(ctx context.Context, pay func(context.Context) (PaymentResult, error)) (PaymentResult, error) {
+	delay := c.paymentRetryDelay
+	for attempt := 1; ; attempt++ {
+		result, err := c.callWallet(ctx, pay)
+		if err == nil || attempt >= c.paymentAttempts || !isRetryable(err) {
+			return result, err
+		}
+
+		c.logEvent(ctx, slog.LevelWarn, "transient wallet error; retrying payment",
+			fmt.Sprintf("⚠️  Payment attempt %d failed (%v); retrying in %s", attempt, err, delay),
+			"attempt", attempt, "error", err, "retry_in", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return PaymentResult{}, fmt.Errorf("%w while waiting to retry the payment (attempt %d: %v)", ctx.Err(), attempt, err)
+		}
+		delay *= 2
+	}
+}
+
+// walletRequestError describes a failure to get a response from a wallet API.
+// A failed dial means the request never left this machine, so it is marked
+// transient; any later failure might have reached the wallet and is not.
+func walletRequestError(wallet string, err error) error {
+	err = fmt.Errorf("%s API error: %w", wallet, err)
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return &TransientError{Err: err}
+	}
+	return err
+}
+
+// payCallError marks err, the failure of a wallet API call that makes or
+// tracks a payment, with ErrPaymentTimeout if the call timed out once the
+// request may have reached the wallet: the payment might then have been
+// sent, so its outcome is unknown.
+func payCallError(err error) error {
+	var netErr net.Error
+	if !isRetryable(err) && errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", ErrPaymentTimeout, err)
+	}
+	return err
+}
+
+// walletStatusError returns a WalletError for an unsuccessful response from
+// a wallet API. Rate limiting and unavailability are reported before the
+// wallet acts on the request, so those are marked transient.
+func walletStatusError(wallet string, resp *http.Response) error {
+	var err error = newWalletError(wallet, resp)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		return &TransientError{Err: err}
+	}
+	return err
+}
+
+// maxWalletErrorBody caps how much of a wallet API's error response is kept
+// in WalletError.Body.
+const maxWalletErrorBody = 512
+
+// newWalletError builds a WalletError from an unsuccessful wallet API
+// response.
+func newWalletError(wallet string, resp *http.Response) *WalletError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	text := strings.TrimSpace(string(body))
+	if len(text) > maxWalletErrorBody {
+		text = strings.ToValidUTF8(text[:maxWalletErrorBody], "") + "..."
+	}
+	return &WalletError{
+		Wallet:     wallet,
+		StatusCode: resp.StatusCode,
+		Message:    jsonErrorMessage(body),
+		Body:       text,
+	}
+}
+
+// jsonErrorMessage returns the message in a JSON error body, such as
+// {"detail": "..."} (LNBits) or {"message": "..."} (LND, Alby, CLN).
+func jsonErrorMessage(body []byte) string {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	for _, key := range []string{"detail", "message", "error", "reason"} {
+		var message string
+		if json.Unmarshal(fields[key], &message) == nil && strings.TrimSpace(message) != "" {
+			return strings.TrimSpace(message)
+		}
+	}
+	return ""
+}
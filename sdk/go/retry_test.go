@@ -0,0 +1,42 @@
+package satgate
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestWalletTimeoutIsUnknownOutcome checks that a wallet API call timing out
+// after the payment request was sent is reported as ErrPaymentTimeout, so the
+// client keeps the amount reserved, while failing to connect at all stays a
+// retryable error.
+func TestWalletTimeoutIsUnknownOutcome(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	wallet := NewLNBitsWallet(srv.URL, "admin-key")
+	setClientTimeout(wallet.client, 50*time.Millisecond)
+	_, err := wallet.PayInvoice("lnbc1")
+	if !errors.Is(err, ErrPaymentTimeout) || !isUnknownOutcome(err) {
+		t.Errorf("timed out pay call: err = %v, want ErrPaymentTimeout", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	wallet = NewLNBitsWallet("http://"+addr, "admin-key")
+	_, err = wallet.PayInvoice("lnbc1")
+	if errors.Is(err, ErrPaymentTimeout) || !isRetryable(err) {
+		t.Errorf("refused connection: err = %v, want a retryable error", err)
+	}
+}
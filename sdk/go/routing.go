@@ -0,0 +1,96 @@
+package satgate
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// ============================================================================
+// Least-Cost Routing Wallet
+// ============================================================================
+
+// FeeEstimator is implemented by wallets that can estimate the routing fee
+// for paying an invoice before paying it (e.g. LNDWallet, via queryroutes).
+type FeeEstimator interface {
+	EstimateFee(invoice string) (feeSat int64, err error)
+}
+
+// RoutingWallet pays each invoice through whichever of several wallets
+// expects the lowest routing fee.
+//
+// Wallets implementing FeeEstimator are asked for an estimate and tried
+// cheapest first; wallets that can't estimate, or whose estimate fails,
+// follow in their configured order. As with FailoverWallet, the next wallet
+// is only tried after a failure that shows nothing was paid.
+type RoutingWallet struct {
+	Wallets []LightningWallet // in priority order
+}
+
+// NewRoutingWallet creates a wallet that routes payments through the
+// cheapest of wallets, given in priority order.
+func NewRoutingWallet(wallets ...LightningWallet) *RoutingWallet {
+	return &RoutingWallet{Wallets: wallets}
+}
+
+// PayInvoice pays invoice through the wallet with the lowest estimated fee.
+func (w *RoutingWallet) PayInvoice(invoice string) (string, error) {
+	return w.PayInvoiceCtx(context.Background(), invoice)
+}
+
+// PayInvoiceCtx is PayInvoice, passing ctx on to wallets that are
+// ContextWallets.
+func (w *RoutingWallet) PayInvoiceCtx(ctx context.Context, invoice string) (string, error) {
+	result, err := w.payInvoiceDetailed(ctx, invoice)
+	return result.Preimage, err
+}
+
+// PayInvoiceDetailed is PayInvoice, also reporting the routing fee actually
+// paid if the chosen wallet is a DetailedWallet.
+func (w *RoutingWallet) PayInvoiceDetailed(invoice string) (PaymentResult, error) {
+	return w.payInvoiceDetailed(context.Background(), invoice)
+}
+
+func (w *RoutingWallet) payInvoiceDetailed(ctx context.Context, invoice string) (PaymentResult, error) {
+	if len(w.Wallets) == 0 {
+		return PaymentResult{}, errors.New("routing wallet has no wallets")
+	}
+	return NewFailoverWallet(w.rank(invoice)...).payInvoiceDetailed(ctx, invoice)
+}
+
+// rank orders the wallets for paying invoice: those with a fee estimate,
+// cheapest first, then the rest in priority order.
+func (w *RoutingWallet) rank(invoice string) []LightningWallet {
+	type candidate struct {
+		wallet LightningWallet
+		feeSat int64
+	}
+	var estimated []candidate
+	var unestimated []LightningWallet
+
+	for _, wallet := range w.Wallets {
+		if estimator, ok := wallet.(FeeEstimator); ok {
+			if fee, err := estimator.EstimateFee(invoice); err == nil {
+				estimated = append(estimated, candidate{wallet, fee})
+				continue
+			}
+		}
+		unestimated = append(unestimated, wallet)
+	}
+
+	// Stable, so equal estimates keep their priority order.
+	sort.SliceStable(estimated, func(i, j int) bool {
+		return estimated[i].feeSat < estimated[j].feeSat
+	})
+
+	ranked := make([]LightningWallet, 0, len(w.Wallets))
+	for _, c := range estimated {
+		ranked = append(ranked, c.wallet)
+	}
+	return append(ranked, unestimated...)
+}
+
+// Close closes every wallet that implements io.Closer.
+func (w *RoutingWallet) Close() error {
+	return NewFailoverWallet(w.Wallets...).Close()
+}
@@ -0,0 +1,74 @@
+// Package satgategrpc pays L402 challenges on gRPC calls.
+//
+// gRPC servers behind an L402 gateway can't answer with HTTP 402, so the
+// challenge arrives as a "www-authenticate" entry in the response header or
+// trailer metadata of a failed RPC. The interceptor pays it with a
+// satgate.Client, so the client's wallet, limits, token cache and stats apply,
+// and retries the RPC once with "authorization" metadata set:
+//
+//	client := satgate.NewClient(wallet)
+//	conn, err := grpc.Dial(target,
+//		grpc.WithUnaryInterceptor(satgategrpc.UnaryClientInterceptor(client)),
+//	)
+package satgategrpc
+
+import (
+	"context"
+	"strings"
+
+	satgate "github.com/SatGate-io/satgate/sdk/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryClientInterceptor returns an interceptor that pays L402 challenges on
+// unary RPCs with client. Tokens are cached by full method name
+// ("/package.Service/Method"), and a cached token is sent up front.
+func UnaryClientInterceptor(client *satgate.Client) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+
+		if auth, ok := client.CachedAuthorization(method); ok {
+			return invoker(withAuthorization(ctx, auth), method, req, reply, cc, opts...)
+		}
+
+		var header, trailer metadata.MD
+		err := invoker(ctx, method, req, reply, cc,
+			append(opts, grpc.Header(&header), grpc.Trailer(&trailer))...)
+		if err == nil {
+			return nil
+		}
+		challenge := findChallenge(header, trailer)
+		if challenge == "" {
+			return err
+		}
+
+		auth, err := client.Authorize(ctx, method, challenge)
+		if err != nil {
+			return err
+		}
+		return invoker(withAuthorization(ctx, auth), method, req, reply, cc, opts...)
+	}
+}
+
+// findChallenge returns the first L402 (or LSAT) challenge in the metadata.
+func findChallenge(mds ...metadata.MD) string {
+	for _, md := range mds {
+		for _, value := range md.Get("www-authenticate") {
+			scheme, _, _ := strings.Cut(strings.TrimSpace(value), " ")
+			if strings.EqualFold(scheme, "L402") || strings.EqualFold(scheme, "LSAT") {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// withAuthorization sets the authorization metadata of ctx to auth,
+// replacing any already set.
+func withAuthorization(ctx context.Context, auth string) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set("authorization", auth)
+	return metadata.NewOutgoingContext(ctx, md)
+}
@@ -0,0 +1,19 @@
+module github.com/SatGate-io/satgate/sdk/go/satgateotel
+
+go 1.21
+
+require (
+	github.com/SatGate-io/satgate/sdk/go v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.2 // indirect
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+)
+
+replace github.com/SatGate-io/satgate/sdk/go => ../
@@ -0,0 +1,64 @@
+// Package satgateotel traces a satgate.Client with OpenTelemetry:
+//
+//	client := satgate.NewClient(wallet,
+//		satgate.WithTracer(satgateotel.NewTracer(otel.GetTracerProvider())),
+//	)
+//
+// Each call gets a "satgate.request" span, a child of the span in the call's
+// context, with "satgate.pay" and "satgate.retry" child spans when it pays a
+// challenge. The payment span carries the invoice amount and the preimage
+// prefix, and failed payments are marked as span errors.
+package satgateotel
+
+import (
+	"context"
+	"fmt"
+
+	satgate "github.com/SatGate-io/satgate/sdk/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans' origin to OpenTelemetry.
+const instrumentationName = "github.com/SatGate-io/satgate/sdk/go/satgateotel"
+
+// NewTracer returns a satgate.Tracer that creates spans with tp.
+func NewTracer(tp trace.TracerProvider) satgate.Tracer {
+	return tracer{tp.Tracer(instrumentationName, trace.WithInstrumentationVersion(satgate.Version))}
+}
+
+type tracer struct {
+	tracer trace.Tracer
+}
+
+func (t tracer) Start(ctx context.Context, name string) (context.Context, satgate.Span) {
+	ctx, s := t.tracer.Start(ctx, name)
+	return ctx, span{s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttribute(key string, value any) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+func (s span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s span) End() { s.span.End() }
@@ -0,0 +1,71 @@
+// Package satgateprom exports a satgate.Client's payment statistics as
+// Prometheus metrics:
+//
+//	client := satgate.NewClient(wallet)
+//	prometheus.MustRegister(satgateprom.NewCollector(client))
+//
+// It is a module of its own so that the core module doesn't depend on
+// Prometheus.
+package satgateprom
+
+import (
+	satgate "github.com/SatGate-io/satgate/sdk/go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector reporting a client's Stats:
+//
+//	satgate_payments_total        invoices paid
+//	satgate_sats_spent_total      satoshis paid
+//	satgate_fees_sat_total        routing fees paid, on top of sats spent
+//	satgate_cache_hits_total      requests served with a cached token
+//	satgate_payment_errors_total  invoices the wallet failed to pay
+//
+// The values are read from the client on every scrape. Client.ResetStats
+// resets them, which Prometheus treats as a counter reset.
+type Collector struct {
+	client *satgate.Client
+
+	payments      *prometheus.Desc
+	satsSpent     *prometheus.Desc
+	fees          *prometheus.Desc
+	cacheHits     *prometheus.Desc
+	paymentErrors *prometheus.Desc
+}
+
+// NewCollector returns a collector for client. To tell several clients
+// apart, register each with prometheus.WrapRegistererWith and a label.
+func NewCollector(client *satgate.Client) *Collector {
+	return &Collector{
+		client: client,
+		payments: prometheus.NewDesc("satgate_payments_total",
+			"Number of L402 invoices paid.", nil, nil),
+		satsSpent: prometheus.NewDesc("satgate_sats_spent_total",
+			"Satoshis paid for L402 invoices.", nil, nil),
+		fees: prometheus.NewDesc("satgate_fees_sat_total",
+			"Routing fees in satoshis paid for L402 invoices, where the wallet reports them.", nil, nil),
+		cacheHits: prometheus.NewDesc("satgate_cache_hits_total",
+			"Requests served with a cached L402 token.", nil, nil),
+		paymentErrors: prometheus.NewDesc("satgate_payment_errors_total",
+			"L402 invoices the wallet failed to pay.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.payments
+	ch <- c.satsSpent
+	ch <- c.fees
+	ch <- c.cacheHits
+	ch <- c.paymentErrors
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.client.Stats()
+	ch <- prometheus.MustNewConstMetric(c.payments, prometheus.CounterValue, float64(stats.PaymentCount))
+	ch <- prometheus.MustNewConstMetric(c.satsSpent, prometheus.CounterValue, float64(stats.PaidSat))
+	ch <- prometheus.MustNewConstMetric(c.fees, prometheus.CounterValue, float64(stats.FeeSat))
+	ch <- prometheus.MustNewConstMetric(c.cacheHits, prometheus.CounterValue, float64(stats.CacheHitCount))
+	ch <- prometheus.MustNewConstMetric(c.paymentErrors, prometheus.CounterValue, float64(stats.FailedPaymentCount))
+}
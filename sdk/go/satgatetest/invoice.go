@@ -0,0 +1,279 @@
+package satgatetest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+// ============================================================================
+// Test Invoices
+// ============================================================================
+
+// Invoice describes a BOLT11 invoice to issue in tests.
+//
+// Encoded invoices are properly signed (by NodeKey) and decode like real
+// ones. Their preimage is derived from the invoice's payment secret, so a
+// MockWallet can pay any invoice issued here without sharing state with the
+// code that issued it.
+type Invoice struct {
+	AmountSat   int64         // 0 for a zero-amount invoice
+	Description string        // optional
+	Timestamp   time.Time     // creation time; defaults to now
+	Expiry      time.Duration // defaults to one hour
+}
+
+// NodeKey is the key test invoices are signed with. Its public key is the
+// payee of every invoice issued by this package.
+var NodeKey, _ = btcec.PrivKeyFromBytes(sha256Sum([]byte("satgatetest node key")))
+
+// invoicePrefix is the BOLT11 prefix of test invoices (regtest).
+const invoicePrefix = "lnbcrt"
+
+// NewInvoice issues a signed test invoice for amountSat, returning it along
+// with its hex-encoded preimage.
+func NewInvoice(amountSat int64, description string) (invoice, preimage string) {
+	return Invoice{AmountSat: amountSat, Description: description}.Encode()
+}
+
+// Encode issues the invoice, returning it along with its hex-encoded
+// preimage. Each call uses a fresh payment secret, and so a fresh preimage.
+func (inv Invoice) Encode() (invoice, preimage string) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic("satgatetest: " + err.Error())
+	}
+	pre := preimageFor(secret)
+	paymentHash := sha256Sum(pre)
+
+	timestamp := inv.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	hrp := invoicePrefix
+	if inv.AmountSat > 0 {
+		// 1 sat = 10 nano-bitcoin.
+		hrp += strconv.FormatInt(inv.AmountSat*10, 10) + "n"
+	}
+
+	var data []byte
+	data = appendUint(data, uint64(timestamp.Unix()), 7)
+	data = appendTag(data, tagPaymentHash, toGroups(paymentHash))
+	data = appendTag(data, tagPaymentSecret, toGroups(secret))
+	if inv.Description != "" {
+		data = appendTag(data, tagDescription, toGroups([]byte(inv.Description)))
+	}
+	if inv.Expiry > 0 {
+		data = appendTag(data, tagExpiry, uintGroups(uint64(inv.Expiry/time.Second)))
+	}
+
+	// Sign sha256(hrp || data as bytes); BOLT11 wants r || s || recovery id.
+	hash := sha256Sum(append([]byte(hrp), toBytes(data)...))
+	compact, err := ecdsa.SignCompact(NodeKey, hash, true)
+	if err != nil {
+		panic("satgatetest: " + err.Error())
+	}
+	sig := append(compact[1:65:65], compact[0]-27-4)
+	data = append(data, toGroups(sig)...)
+
+	return bech32Encode(hrp, data), hex.EncodeToString(pre)
+}
+
+// PreimageFor returns the hex-encoded preimage of an invoice issued by this
+// package, or an error if invoice wasn't issued here.
+func PreimageFor(invoice string) (string, error) {
+	secret, err := paymentSecret(invoice)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(preimageFor(secret)), nil
+}
+
+func preimageFor(secret []byte) []byte {
+	return sha256Sum(append([]byte("satgatetest preimage:"), secret...))
+}
+
+// paymentSecret extracts the payment secret ('s' field) from invoice.
+func paymentSecret(invoice string) ([]byte, error) {
+	invoice = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(invoice)), "lightning:")
+	if !strings.HasPrefix(invoice, invoicePrefix) {
+		return nil, errors.New("not a satgatetest invoice")
+	}
+	data, err := bech32Decode(invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	const timestampLen, signatureLen = 7, 104
+	if len(data) < timestampLen+signatureLen {
+		return nil, errors.New("invoice too short")
+	}
+	fields := data[timestampLen : len(data)-signatureLen]
+	for len(fields) >= 3 {
+		tag, length := fields[0], int(fields[1])<<5|int(fields[2])
+		if len(fields) < 3+length {
+			break
+		}
+		if tag == tagPaymentSecret && length == 52 {
+			return fromGroups(fields[3 : 3+length]), nil
+		}
+		fields = fields[3+length:]
+	}
+	return nil, errors.New("not a satgatetest invoice: no payment secret")
+}
+
+// BOLT11 tagged field types.
+const (
+	tagPaymentHash   = 1  // 'p'
+	tagExpiry        = 6  // 'x'
+	tagDescription   = 13 // 'd'
+	tagPaymentSecret = 16 // 's'
+)
+
+func appendTag(data []byte, tag byte, value []byte) []byte {
+	return append(append(data, tag, byte(len(value)>>5), byte(len(value)&31)), value...)
+}
+
+// appendUint appends v as n big-endian 5-bit groups.
+func appendUint(data []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		data = append(data, byte(v>>(5*uint(i)))&31)
+	}
+	return data
+}
+
+// uintGroups encodes v in as few 5-bit groups as possible.
+func uintGroups(v uint64) []byte {
+	n := 1
+	for v>>(5*uint(n)) != 0 {
+		n++
+	}
+	return appendUint(nil, v, n)
+}
+
+// toGroups regroups bytes into 5-bit groups, zero-padding the last.
+func toGroups(b []byte) []byte {
+	var out []byte
+	var acc uint32
+	var bits uint
+	for _, v := range b {
+		acc = acc<<8 | uint32(v)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out = append(out, byte(acc>>bits)&31)
+		}
+	}
+	if bits > 0 {
+		out = append(out, byte(acc<<(5-bits))&31)
+	}
+	return out
+}
+
+// toBytes regroups 5-bit groups into bytes, zero-padding the last.
+func toBytes(groups []byte) []byte {
+	var out []byte
+	var acc uint32
+	var bits uint
+	for _, v := range groups {
+		acc = acc<<5 | uint32(v)
+		bits += 5
+		for bits >= 8 {
+			bits -= 8
+			out = append(out, byte(acc>>bits))
+		}
+	}
+	if bits > 0 {
+		out = append(out, byte(acc<<(8-bits)))
+	}
+	return out
+}
+
+// fromGroups regroups 5-bit groups into bytes, dropping padding.
+func fromGroups(groups []byte) []byte {
+	out := toBytes(groups)
+	return out[:len(groups)*5/8]
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// ============================================================================
+// Bech32
+// ============================================================================
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Encode(hrp string, data []byte) string {
+	values := append(bech32HRPExpand(hrp), data...)
+	checksum := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ 1
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range data {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(checksum>>(5*uint(5-i)))&31])
+	}
+	return sb.String()
+}
+
+// bech32Decode returns the data groups of a bech32 string, checksum verified
+// and stripped.
+func bech32Decode(s string) ([]byte, error) {
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return nil, errors.New("bech32: invalid separator position")
+	}
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return nil, errors.New("bech32: invalid character")
+		}
+		data = append(data, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(s[:sep]), data...)) != 1 {
+		return nil, errors.New("bech32: invalid checksum")
+	}
+	return data[:len(data)-6], nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package satgatetest
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// ============================================================================
+// L402 Test Server
+// ============================================================================
+
+// NewL402Server starts an httptest.Server that charges price sats per token
+// for every path. Unpaid requests get a 402 with a
+// `WWW-Authenticate: L402 macaroon="...", invoice="..."` challenge whose
+// invoice a MockWallet can pay; requests presenting a valid token get
+// "OK\n". The caller must Close the server.
+func NewL402Server(price int64) *httptest.Server {
+	return httptest.NewServer(L402Handler(price, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "OK")
+	})))
+}
+
+// L402Handler protects next with L402: requests without a valid token get a
+// 402 challenge for a fresh invoice of price sats, and requests presenting
+// the challenge's macaroon with the invoice's preimage (as
+// `Authorization: L402 <macaroon>:<preimage>`, or the legacy LSAT scheme)
+// are passed to next. Tokens are checked statelessly and never expire.
+func L402Handler(price int64, next http.Handler) http.Handler {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("satgatetest: " + err.Error())
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if validToken(key, r.Header.Get("Authorization")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		invoice, preimage := NewInvoice(price, "satgatetest "+r.URL.Path)
+		pre, _ := hex.DecodeString(preimage)
+		macaroon := mintMacaroon(key, sha256Sum(pre))
+
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`L402 macaroon="%s", invoice="%s"`, macaroon, invoice))
+		http.Error(w, "Payment Required", http.StatusPaymentRequired)
+	})
+}
+
+// mintMacaroon returns a stand-in macaroon binding paymentHash: the hash
+// followed by its HMAC under key, base64-encoded. It is not a real macaroon,
+// which clients treat as opaque anyway.
+func mintMacaroon(key, paymentHash []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(paymentHash)
+	return base64.StdEncoding.EncodeToString(mac.Sum(append([]byte(nil), paymentHash...)))
+}
+
+// validToken checks an "L402 <macaroon>:<preimage>" Authorization header.
+func validToken(key []byte, auth string) bool {
+	scheme, token, ok := strings.Cut(auth, " ")
+	if !ok || !(strings.EqualFold(scheme, "L402") || strings.EqualFold(scheme, "LSAT")) {
+		return false
+	}
+	macaroon, preimageHex, ok := strings.Cut(strings.TrimSpace(token), ":")
+	if !ok {
+		return false
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(macaroon)
+	if err != nil || len(raw) != 64 {
+		return false
+	}
+	paymentHash := raw[:32]
+	if !hmac.Equal([]byte(mintMacaroon(key, paymentHash)), []byte(macaroon)) {
+		return false
+	}
+
+	preimage, err := hex.DecodeString(preimageHex)
+	return err == nil && hmac.Equal(sha256Sum(preimage), paymentHash)
+}
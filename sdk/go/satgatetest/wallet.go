@@ -0,0 +1,108 @@
+// Package satgatetest provides test doubles for code that uses the satgate
+// package: a scriptable MockWallet, signed test invoices that it can pay, and
+// an in-process L402 server that issues them.
+package satgatetest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// ============================================================================
+// Mock Wallet
+// ============================================================================
+
+// MockWallet is an in-memory satgate.LightningWallet for tests. It records
+// every invoice it is asked to pay and, by default, pays successfully:
+// invoices issued by this package get their real preimage, so the client's
+// preimage verification passes; any other invoice gets a deterministic fake
+// preimage. Responses can be scripted with QueueResponse or FailNext.
+//
+// A MockWallet is safe for concurrent use.
+type MockWallet struct {
+	mu       sync.Mutex
+	attempts []string
+	paid     []string
+	script   []mockResponse
+}
+
+type mockResponse struct {
+	preimage string
+	err      error
+}
+
+// NewMockWallet creates a MockWallet that pays every invoice.
+func NewMockWallet() *MockWallet {
+	return &MockWallet{}
+}
+
+// PayInvoice "pays" invoice, returning the next scripted response if any.
+func (w *MockWallet) PayInvoice(invoice string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.attempts = append(w.attempts, invoice)
+
+	if len(w.script) > 0 {
+		next := w.script[0]
+		w.script = w.script[1:]
+		if next.err != nil {
+			return "", next.err
+		}
+		if next.preimage != "" {
+			w.paid = append(w.paid, invoice)
+			return next.preimage, nil
+		}
+	}
+
+	w.paid = append(w.paid, invoice)
+	if preimage, err := PreimageFor(invoice); err == nil {
+		return preimage, nil
+	}
+	return FakePreimage(invoice), nil
+}
+
+// QueueResponse scripts the result of a PayInvoice call: err if non-nil,
+// otherwise preimage (or the default preimage, if empty). Queued responses
+// are used in order, one per call.
+func (w *MockWallet) QueueResponse(preimage string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.script = append(w.script, mockResponse{preimage: preimage, err: err})
+}
+
+// FailNext makes the next PayInvoice call fail with err.
+func (w *MockWallet) FailNext(err error) {
+	w.QueueResponse("", err)
+}
+
+// Paid returns the invoices paid successfully, in order.
+func (w *MockWallet) Paid() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.paid...)
+}
+
+// Attempts returns every invoice PayInvoice was called with, including
+// failed payments, in order.
+func (w *MockWallet) Attempts() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.attempts...)
+}
+
+// Reset forgets recorded payments and scripted responses.
+func (w *MockWallet) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.attempts, w.paid, w.script = nil, nil, nil
+}
+
+// FakePreimage returns the deterministic preimage MockWallet reports for an
+// invoice not issued by this package. It won't match the invoice's payment
+// hash, so the client rejects it with satgate.ErrPreimageMismatch.
+func FakePreimage(invoice string) string {
+	sum := sha256.Sum256([]byte("satgatetest fake preimage:" + invoice))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,102 @@
+package satgate
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ============================================================================
+// Token Scope
+// ============================================================================
+
+// macaroonScope returns the URL prefix a token is valid for, if its macaroon
+// says it covers more than the URL it was paid for at: a "path=" caveat
+// scopes it to that path (and everything below it) on the same origin. ok is
+// false if the macaroon has no such caveat or rawURL can't be parsed, in
+// which case the token is only reused for its own cache key.
+//
+// "service=" and "services=" caveats don't widen the scope: they name the
+// services a token pays for, not where they are served, and aperture puts
+// them on every macaroon while fronting several services on one host.
+func macaroonScope(mac, rawURL string) (prefix string, ok bool) {
+	caveats, err := macaroonCaveats(mac)
+	if err != nil {
+		return "", false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", false
+	}
+	origin := u.Scheme + "://" + u.Host
+
+	path := ""
+	for _, caveat := range caveats {
+		key, value, found := strings.Cut(caveat, "=")
+		if found && strings.TrimSpace(key) == "path" {
+			path = strings.TrimSuffix(strings.TrimSpace(value), "*")
+		}
+	}
+	if path == "" {
+		return "", false
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return origin + path, true
+}
+
+// tokenScope is the scope of a cached token: the URL prefix its macaroon
+// covers, and the method of the request it was paid for.
+type tokenScope struct {
+	prefix string
+	method string
+}
+
+// inScope reports whether rawURL falls under prefix, a scope returned by
+// macaroonScope. A prefix matches whole path segments only: "/api" covers
+// "/api" and "/api/x" but not "/apix".
+func inScope(rawURL, prefix string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	target := u.Scheme + "://" + u.Host + u.EscapedPath()
+	if !strings.HasPrefix(target, prefix) {
+		return false
+	}
+	return len(target) == len(prefix) || strings.HasSuffix(prefix, "/") || target[len(prefix)] == '/'
+}
+
+// scopedKey returns the cache key of a token whose scope covers rawURL,
+// preferring the most specific scope. Only scopes for which match returns
+// true are considered.
+func (tc *TokenCache) scopedKey(rawURL string, match func(tokenScope) bool) (string, bool) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	best, bestKey := "", ""
+	for key, scope := range tc.scopes {
+		if len(scope.prefix) > len(best) && inScope(rawURL, scope.prefix) && match(scope) {
+			best, bestKey = scope.prefix, key
+		}
+	}
+	return bestKey, best != ""
+}
+
+// cachedTokenFor returns a valid token for req: the one cached under its own
+// key or, failing that, one whose macaroon scopes it to req's URL. A scoped
+// token is only used if the cache key function treats req's method like
+// the one it was paid for with, so CacheKeyByMethod keeps methods apart.
+func (c *Client) cachedTokenFor(req *request) *cachedToken {
+	key := c.keyFor(req)
+	if token := c.getCachedToken(key); token != nil {
+		return token
+	}
+	sameMethod := func(scope tokenScope) bool {
+		return scope.method == req.method || c.keyFor(&request{method: scope.method, url: req.url}) == key
+	}
+	if scopedKey, ok := c.cache.scopedKey(req.url, sameMethod); ok {
+		return c.getCachedToken(scopedKey)
+	}
+	return nil
+}
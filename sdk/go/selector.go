@@ -0,0 +1,101 @@
+package satgate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// ============================================================================
+// Invoice Selection
+// ============================================================================
+
+// WithInvoiceSelector sets how the client chooses between the invoices of a
+// challenge that offers several, e.g. one per access tier. selector is given
+// the decoded invoices, in the order the server sent them, and returns the
+// index of the one to pay; an index out of range pays none and fails with
+// ErrPaymentRejected. By default the cheapest invoice that names an amount is
+// paid.
+//
+// Offers that aren't BOLT11 invoices (BOLT12 offers, keysend) can't be
+// compared and are left out of the choice.
+func WithInvoiceSelector(selector func([]Invoice) int) ClientOption {
+	return func(client *Client) {
+		client.invoiceSelector = selector
+	}
+}
+
+// cheapestInvoice picks the invoice with the lowest amount, ignoring
+// zero-amount invoices unless they are all there is.
+func cheapestInvoice(invoices []Invoice) int {
+	best := 0
+	for i, inv := range invoices {
+		if inv.AmountMsat == 0 {
+			continue
+		}
+		if invoices[best].AmountMsat == 0 || inv.AmountMsat < invoices[best].AmountMsat {
+			best = i
+		}
+	}
+	return best
+}
+
+// readChallenge reads the challenge in resp, with the parser set by
+// WithChallengeParser if any, and if it offers several invoices, picks the
+// one to pay.
+func (c *Client) readChallenge(ctx context.Context, resp *http.Response) (macaroon, invoice string, found bool, err error) {
+	if c.challengeParser != nil {
+		macaroon, invoice, err = c.challengeParser(resp)
+		switch {
+		case err != nil:
+			return "", "", true, fmt.Errorf("%w: %v", ErrInvalidL402Header, err)
+		case macaroon == "" && invoice == "":
+			return "", "", false, nil
+		case macaroon == "" || invoice == "":
+			return "", "", true, fmt.Errorf("%w: challenge parser returned a macaroon or invoice but not both", ErrInvalidL402Header)
+		}
+		return macaroon, invoice, true, nil
+	}
+
+	options, found, err := readChallenges(resp)
+	if !found || err != nil {
+		return "", "", found, err
+	}
+	macaroon, invoice, err = c.selectInvoice(ctx, options)
+	return macaroon, invoice, true, err
+}
+
+// selectInvoice chooses between the options of a challenge.
+func (c *Client) selectInvoice(ctx context.Context, options []challengeOption) (macaroon, invoice string, err error) {
+	if len(options) == 1 {
+		return options[0].macaroon, options[0].invoice, nil
+	}
+
+	var candidates []challengeOption
+	var invoices []Invoice
+	for _, option := range options {
+		if inv, err := DecodeInvoice(option.invoice); err == nil {
+			candidates = append(candidates, option)
+			invoices = append(invoices, *inv)
+		}
+	}
+	if len(candidates) == 0 {
+		// Nothing to compare: take the server's first offer.
+		return options[0].macaroon, options[0].invoice, nil
+	}
+
+	selector := c.invoiceSelector
+	if selector == nil {
+		selector = cheapestInvoice
+	}
+	i := selector(invoices)
+	if i < 0 || i >= len(candidates) {
+		return "", "", fmt.Errorf("%w: invoice selector chose none of %d invoices", ErrPaymentRejected, len(candidates))
+	}
+
+	c.logEvent(ctx, slog.LevelDebug, "selected invoice from challenge",
+		fmt.Sprintf("🧾 Challenge offers %d invoices; paying the one for %d sats", len(candidates), invoices[i].AmountSat),
+		"invoices", len(candidates), "selected", i, "invoice_amount_sat", invoices[i].AmountSat)
+	return candidates[i].macaroon, candidates[i].invoice, nil
+}
@@ -0,0 +1,61 @@
+package satgate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Settlement Polling
+// ============================================================================
+
+// settlementPollInterval is how often a wallet whose API answered "pending"
+// is asked whether the payment has settled.
+var settlementPollInterval = time.Second
+
+// defaultSettlementTimeout bounds polling for a wallet without an API
+// timeout.
+const defaultSettlementTimeout = 60 * time.Second
+
+// awaitSettlement polls check until it reports the payment settled (a
+// preimage) or failed (an error), giving up with ErrPaymentPending after
+// timeout or once ctx is done. Transient lookup errors are polled through.
+// The payment has been accepted by then, so no error returned may look like
+// one for a payment that was never made (see IsPreSettlementError): paying
+// again elsewhere could pay twice.
+func awaitSettlement(ctx context.Context, wallet string, timeout time.Duration, check func() (preimage string, err error)) (string, error) {
+	if timeout <= 0 {
+		timeout = defaultSettlementTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		preimage, err := check()
+		switch {
+		case preimage != "":
+			return preimage, nil
+		case err != nil && IsPreSettlementError(err) && !isRetryable(err):
+			return "", fmt.Errorf("%s payment status: %v", wallet, err)
+		case err != nil && !isRetryable(err):
+			return "", fmt.Errorf("%s payment status: %w", wallet, err)
+		}
+		if time.Now().Add(settlementPollInterval).After(deadline) {
+			return "", fmt.Errorf("%s: %w after %s", wallet, ErrPaymentPending, timeout)
+		}
+
+		timer := time.NewTimer(settlementPollInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return "", fmt.Errorf("%s: %w: %w", wallet, ErrPaymentPending, ctx.Err())
+		}
+	}
+}
+
+// isZeroPreimage reports whether preimage is missing or all zeros, as some
+// wallets report it while a payment is in flight.
+func isZeroPreimage(preimage string) bool {
+	return strings.Trim(preimage, "0") == ""
+}
@@ -0,0 +1,135 @@
+package satgate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ============================================================================
+// Payment Timeout
+// ============================================================================
+
+// WithPaymentTimeout sets how long the client waits for the wallet to pay an
+// invoice, independently of the timeout of the HTTP client used for API
+// requests. Lightning payments can legitimately take longer to settle than an
+// API call should, e.g. 120s to pay while API calls time out after 10s.
+//
+// The built-in wallets' own API timeouts (30-60s by default) are set to d as
+// well, which affects every client sharing the wallet; calls the wallet is
+// already making keep the timeout they started with. A wallet that still
+// hasn't answered after d is abandoned and the call fails with
+// ErrPaymentTimeout. The payment may nevertheless complete later, so until
+// the wallet does answer, the amount stays reserved against the budget and
+// spend rate limit, and other requests for the same token wait for it. A
+// late preimage is then cached and the payment counted as usual.
+func WithPaymentTimeout(d time.Duration) ClientOption {
+	return func(client *Client) {
+		client.paymentTimeout = d
+	}
+}
+
+// paymentTimeoutSetter is implemented by the built-in wallets, whose API
+// clients have a fixed default timeout.
+type paymentTimeoutSetter interface {
+	setPaymentTimeout(d time.Duration)
+}
+
+// setWalletTimeout sets the API timeout of the built-in wallets in wallet
+// to d.
+func setWalletTimeout(wallet LightningWallet, d time.Duration) {
+	eachWallet(wallet, func(wallet LightningWallet) {
+		if setter, ok := wallet.(paymentTimeoutSetter); ok {
+			setter.setPaymentTimeout(d)
+		}
+	})
+}
+
+// setClientTimeout sets the timeout of the requests client makes from now on.
+func setClientTimeout(client *walletClient, d time.Duration) {
+	client.update(func(client *http.Client, _ *http.Transport) {
+		client.Timeout = d
+	})
+}
+
+func (w *LNBitsWallet) setPaymentTimeout(d time.Duration)   { setClientTimeout(w.client, d) }
+func (w *AlbyWallet) setPaymentTimeout(d time.Duration)     { setClientTimeout(w.client, d) }
+func (w *CLNWallet) setPaymentTimeout(d time.Duration)      { setClientTimeout(w.client, d) }
+func (w *PhoenixdWallet) setPaymentTimeout(d time.Duration) { setClientTimeout(w.client, d) }
+func (w *LNURLWallet) setPaymentTimeout(d time.Duration)    { setClientTimeout(w.client, d) }
+
+func (w *LNDWallet) setPaymentTimeout(d time.Duration) {
+	w.configure(func() { w.timeout = d })
+}
+
+func (w *NWCWallet) setPaymentTimeout(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.Timeout = d
+}
+
+// callWallet makes one payment attempt with pay, a wallet call. pay is given
+// ctx, ending at the payment timeout if one is set, so a ContextWallet stops
+// when the request is cancelled or the timeout passes; the client stops
+// waiting then too, even for a wallet that can't be cancelled. A payment
+// stopped that way may already have been sent, so the error wraps
+// ErrPaymentInterrupted or ErrPaymentTimeout, and while the wallet is still
+// running it is an abandonedPayment carrying the wallet's eventual answer.
+func (c *Client) callWallet(ctx context.Context, pay func(context.Context) (PaymentResult, error)) (PaymentResult, error) {
+	payCtx, cancel := context.WithCancel(ctx)
+	if c.paymentTimeout > 0 {
+		payCtx, cancel = context.WithTimeout(ctx, c.paymentTimeout)
+	}
+
+	// stopped is the error for a payment the client stopped waiting for.
+	stopped := func() error {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%w: %w", ErrPaymentInterrupted, err)
+		}
+		return fmt.Errorf("%w: no response from the wallet within %s", ErrPaymentTimeout, c.paymentTimeout)
+	}
+
+	done := make(chan walletAnswer, 1)
+	go func() {
+		defer cancel()
+		result, err := pay(payCtx)
+		// A ContextWallet that gave up because we stopped waiting can't
+		// tell whether its payment went out either.
+		if err != nil && payCtx.Err() != nil {
+			result, err = PaymentResult{}, stopped()
+		}
+		done <- walletAnswer{result, err}
+	}()
+
+	select {
+	case answer := <-done:
+		return answer.result, answer.err
+	case <-payCtx.Done():
+		return PaymentResult{}, &abandonedPayment{err: stopped(), answer: done}
+	}
+}
+
+// walletAnswer is what a wallet call returned.
+type walletAnswer struct {
+	result PaymentResult
+	err    error
+}
+
+// abandonedPayment is the error for a wallet call given up on while it was
+// still running. The wallet's eventual answer arrives on answer.
+type abandonedPayment struct {
+	err    error
+	answer <-chan walletAnswer
+}
+
+func (e *abandonedPayment) Error() string { return e.err.Error() }
+
+func (e *abandonedPayment) Unwrap() error { return e.err }
+
+// isUnknownOutcome reports whether err leaves open whether the wallet paid.
+func isUnknownOutcome(err error) bool {
+	return errors.Is(err, ErrPaymentTimeout) || errors.Is(err, ErrPaymentPending) ||
+		errors.Is(err, ErrPaymentInterrupted)
+}
@@ -0,0 +1,59 @@
+package satgate
+
+import "context"
+
+// ============================================================================
+// Tracing
+// ============================================================================
+
+// Tracer starts spans for the stages of a request: "satgate.request" for the
+// whole call, with "satgate.pay" and "satgate.retry" as children when a
+// challenge is paid. The satgateotel package adapts OpenTelemetry; the core
+// package has no tracing dependency.
+type Tracer interface {
+	// Start starts a span named name as a child of any span in ctx, and
+	// returns a context carrying the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute records an attribute. value is a string, bool, int or
+	// int64.
+	SetAttribute(key string, value any)
+
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+
+	End()
+}
+
+// WithTracer traces requests with tracer.
+func WithTracer(tracer Tracer) ClientOption {
+	return func(client *Client) {
+		client.tracer = tracer
+	}
+}
+
+// startSpan starts a span with the client's tracer, or a no-op span if there
+// is none.
+func (c *Client) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if c.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return c.tracer.Start(ctx, name)
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, any) {}
+func (noopSpan) RecordError(error)        {}
+func (noopSpan) End()                     {}
@@ -0,0 +1,52 @@
+package satgate
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ============================================================================
+// http.RoundTripper
+// ============================================================================
+
+// RoundTripper returns an http.RoundTripper that handles L402 challenges the
+// way the client's own methods do, so any *http.Client (or library that takes
+// one) gets L402 support by setting it as the Transport:
+//
+//	httpClient := &http.Client{Transport: client.RoundTripper()}
+//
+// The token cache, budget and limits, callbacks and stats of c all apply.
+// Requests are sent with c's own HTTP client, so don't pass an *http.Client
+// that uses this RoundTripper to WithHTTPClient.
+func (c *Client) RoundTripper() http.RoundTripper {
+	return roundTripper{c}
+}
+
+type roundTripper struct {
+	client *Client
+}
+
+// RoundTrip sends r, paying any L402 challenge and retrying once. The body is
+// read up front so it can be sent again with the token.
+func (t roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	req := &request{method: r.Method, url: r.URL.String(), headers: r.Header.Clone()}
+	if r.Body != nil && r.Body != http.NoBody {
+		data, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %w", err)
+		}
+		req.body = data
+	}
+
+	result, err := t.client.do(r.Context(), req)
+	if err != nil {
+		// A RoundTripper returns either a response or an error, not both.
+		if result != nil && result.Response != nil {
+			discardBody(result.Response)
+		}
+		return nil, err
+	}
+	return result.Response, nil
+}
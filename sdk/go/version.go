@@ -0,0 +1,5 @@
+package satgate
+
+// Version is the version of the SatGate Go SDK. It is sent in the default
+// User-Agent header.
+const Version = "0.3.0"
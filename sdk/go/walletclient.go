@@ -0,0 +1,67 @@
+package satgate
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// Wallet HTTP Clients
+// ============================================================================
+
+// walletClient is the HTTP client of a built-in wallet. Client options that
+// reconfigure the wallet (WithProxy, WithPaymentTimeout, WithInsecureTLS)
+// never modify the current http.Client: they swap in a modified copy, so a
+// wallet that another client is already paying with can be reconfigured
+// safely. Calls already in progress finish with the settings they started
+// with.
+type walletClient struct {
+	mu     sync.Mutex // serializes updates
+	client atomic.Pointer[http.Client]
+}
+
+func newWalletClient(timeout time.Duration) *walletClient {
+	wc := &walletClient{}
+	wc.client.Store(&http.Client{Timeout: timeout})
+	return wc
+}
+
+// Do sends req with the current client.
+func (wc *walletClient) Do(req *http.Request) (*http.Response, error) {
+	return wc.client.Load().Do(req)
+}
+
+// Get issues a GET to url with the current client.
+func (wc *walletClient) Get(url string) (*http.Response, error) {
+	return wc.client.Load().Get(url)
+}
+
+// timeout returns the current client's timeout.
+func (wc *walletClient) timeout() time.Duration {
+	return wc.client.Load().Timeout
+}
+
+// update replaces the client with a copy modified by fn. fn is given a clone
+// of the client's transport (of http.DefaultTransport if it has none), so
+// that neither the old client's nor the default transport is changed.
+func (wc *walletClient) update(fn func(client *http.Client, transport *http.Transport)) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	old := wc.client.Load()
+	client := *old
+	transport, ok := old.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	fn(&client, transport)
+	client.Transport = transport
+	wc.client.Store(&client)
+	// The old client's connections won't be reused; close them once idle.
+	if old.Transport != nil {
+		old.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,91 @@
+//go:build js && wasm
+
+package satgate
+
+import (
+	"errors"
+	"fmt"
+	"syscall/js"
+)
+
+// ============================================================================
+// WebLN Wallet (browser, GOOS=js GOARCH=wasm)
+// ============================================================================
+
+// WebLNWallet pays through the browser's WebLN provider (window.webln, as
+// injected by Alby, Bitcoin Connect and similar extensions). It is only
+// available in Go code compiled to WebAssembly for the browser.
+//
+// PayInvoice blocks until the provider settles the payment, so don't call it
+// from a JavaScript callback: run the request in its own goroutine.
+type WebLNWallet struct {
+	enabled bool
+}
+
+// NewWebLNWallet creates a wallet backed by window.webln.
+func NewWebLNWallet() *WebLNWallet {
+	return &WebLNWallet{}
+}
+
+// PayInvoice pays invoice with webln.sendPayment, enabling the provider
+// first if needed (which may prompt the user).
+func (w *WebLNWallet) PayInvoice(invoice string) (string, error) {
+	webln := js.Global().Get("webln")
+	if webln.IsUndefined() || webln.IsNull() {
+		return "", errors.New("WebLN: no window.webln provider found")
+	}
+
+	if !w.enabled {
+		if _, err := await(webln.Call("enable")); err != nil {
+			return "", fmt.Errorf("WebLN enable failed: %w", err)
+		}
+		w.enabled = true
+	}
+
+	result, err := await(webln.Call("sendPayment", invoice))
+	if err != nil {
+		return "", fmt.Errorf("WebLN payment failed: %w", err)
+	}
+	preimage := result.Get("preimage")
+	if preimage.Type() != js.TypeString || preimage.String() == "" {
+		return "", fmt.Errorf("WebLN: %w", ErrNoPreimage)
+	}
+	return preimage.String(), nil
+}
+
+// await blocks until promise settles and returns its value, or its rejection
+// reason as an error.
+func await(promise js.Value) (js.Value, error) {
+	type outcome struct {
+		value js.Value
+		err   error
+	}
+	done := make(chan outcome, 1)
+
+	onResolve := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		done <- outcome{value: arg0(args)}
+		return nil
+	})
+	defer onResolve.Release()
+	onReject := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		reason := arg0(args)
+		msg := reason.String()
+		if reason.Type() == js.TypeObject && reason.Get("message").Type() == js.TypeString {
+			msg = reason.Get("message").String()
+		}
+		done <- outcome{err: errors.New(msg)}
+		return nil
+	})
+	defer onReject.Release()
+
+	promise.Call("then", onResolve, onReject)
+	result := <-done
+	return result.value, result.err
+}
+
+func arg0(args []js.Value) js.Value {
+	if len(args) == 0 {
+		return js.Undefined()
+	}
+	return args[0]
+}